@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ArchiveLimits bound the expansion of zip and tar files, against zip bombs.
+// they apply to all of a question's files together.
+type ArchiveLimits struct {
+	MaxEntries int   // files expanded; if zero, 1000
+	MaxSize    int64 // bytes expanded; if zero, 256MB
+	MaxDepth   int   // of archives within archives; if zero, 3
+}
+
+func (l ArchiveLimits) withDefaults() ArchiveLimits {
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = 1000
+	}
+	if l.MaxSize <= 0 {
+		l.MaxSize = 256 << 20
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = 3
+	}
+	return l
+}
+
+// ErrArchiveLimit is returned when an archive exceeds the ArchiveLimits
+var ErrArchiveLimit = errors.New("archive limit exceeded")
+
+// expansion tracks what's been expanded from archives
+type expansion struct {
+	limits  ArchiveLimits
+	entries int
+	size    int64
+	depth   int
+}
+
+// read reads a file of an archive, counting it against the limits. size is
+// as claimed by the archive, which may lie.
+func (e *expansion) read(size int64, r io.Reader) ([]byte, error) {
+	e.entries++
+	if e.entries > e.limits.MaxEntries {
+		return nil, fmt.Errorf("more than %d files: %w", e.limits.MaxEntries, ErrArchiveLimit)
+	}
+	left := e.limits.MaxSize - e.size
+	if size > left {
+		return nil, fmt.Errorf("more than %d bytes: %w", e.limits.MaxSize, ErrArchiveLimit)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, left+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > left {
+		return nil, fmt.Errorf("more than %d bytes: %w", e.limits.MaxSize, ErrArchiveLimit)
+	}
+	e.size += int64(len(data))
+	return data, nil
+}
+
+func init() {
+	RegisterConverter(ConverterFunc(expand), "application/zip", "application/gzip", "application/x-tar")
+}
+
+// expand converts the supported files in an archive, named by their paths
+// within it and transcribed as the archive would be, and lists the
+// archive's contents
+func expand(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	if x.expansion.depth >= x.expansion.limits.MaxDepth {
+		return nil, fmt.Errorf("%q: archives nested more than %d deep: %w", f.Name, x.expansion.limits.MaxDepth, ErrArchiveLimit)
+	}
+	if x.expansion.depth > 0 {
+		// a nested archive's bytes were counted as a member of its parent,
+		// and its members are counted in turn, so each byte is counted once:
+		x.expansion.size -= int64(len(f.Content))
+	}
+	x.expansion.depth++
+	defer func() { x.expansion.depth-- }()
+	var parts []Part
+	var listing, skipped []string
+	err := walkArchive(f, func(name string, size int64, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name = path.Clean(strings.TrimPrefix(name, "/"))
+		if junk(name) {
+			return nil
+		}
+		data, err := x.expansion.read(size, r)
+		if err != nil {
+			return fmt.Errorf("%q: %w", f.Name, err)
+		}
+		member, c, err := x.identify(File{
+			Name:          path.Join(f.Name, name),
+			Content:       data,
+			Timestamps:    f.Timestamps,
+			Transcription: f.Transcription,
+		})
+		if err != nil {
+			skipped = append(skipped, name)
+			return nil
+		}
+		p, err := c.Convert(ctx, x, member)
+		if err != nil {
+			return err
+		}
+		listing = append(listing, name)
+		parts = append(parts, p...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	contents := fmt.Sprintf("files included below:\n%s", strings.Join(listing, "\n"))
+	if len(skipped) > 0 {
+		contents += fmt.Sprintf("\n\nfiles skipped, being of unsupported types:\n%s", strings.Join(skipped, "\n"))
+	}
+	return append([]Part{TextPart(f, "here are the contents of an %s file named %q, whose files follow, named by their paths within it", contents)}, parts...), nil
+}
+
+// junk is whether a path is operating system clutter
+func junk(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(name, "__MACOSX/") || base == ".DS_Store" || base == "Thumbs.db" || strings.HasPrefix(base, "._")
+}
+
+// walkArchive visits the regular files of a zip, tar, or gzipped tar, in
+// order; a gzipped file that isn't a tar is its only file
+func walkArchive(f File, visit func(name string, size int64, r io.Reader) error) error {
+	switch f.ContentType {
+	case "application/zip":
+		z, err := zip.NewReader(bytes.NewReader(f.Content), int64(len(f.Content)))
+		if err != nil {
+			return fmt.Errorf("can't read archive %q: %w", f.Name, err)
+		}
+		for _, zf := range z.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			r, err := zf.Open()
+			if err != nil {
+				return fmt.Errorf("can't read %q in %q: %w", zf.Name, f.Name, err)
+			}
+			err = visit(zf.Name, int64(zf.UncompressedSize64), r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "application/gzip":
+		z, err := gzip.NewReader(bytes.NewReader(f.Content))
+		if err != nil {
+			return fmt.Errorf("can't read archive %q: %w", f.Name, err)
+		}
+		defer z.Close()
+		// peek for a tar header:
+		head := make([]byte, 512)
+		n, err := io.ReadFull(z, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return fmt.Errorf("can't read archive %q: %w", f.Name, err)
+		}
+		rest := io.MultiReader(bytes.NewReader(head[:n]), z)
+		if n >= 262 && string(head[257:262]) == "ustar" {
+			return walkTar(f, rest, visit)
+		}
+		name := z.Name
+		if len(name) == 0 {
+			name = strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+		}
+		return visit(name, 0, rest)
+	case "application/x-tar":
+		return walkTar(f, bytes.NewReader(f.Content), visit)
+	}
+	return fmt.Errorf("%q is not an archive", f.Name)
+}
+
+func walkTar(f File, r io.Reader, visit func(name string, size int64, r io.Reader) error) error {
+	t := tar.NewReader(r)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("can't read archive %q: %w", f.Name, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(h.Name, h.Size, t); err != nil {
+			return err
+		}
+	}
+}
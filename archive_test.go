@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"xoba.com/llm/client"
+)
+
+type member struct {
+	name, content string
+}
+
+func zipped(t *testing.T, members ...member) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for _, m := range members {
+		w, err := z.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(m.content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func tarGzipped(t *testing.T, members ...member) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	z := gzip.NewWriter(&b)
+	w := tar.NewWriter(z)
+	for _, m := range members {
+		if err := w.WriteHeader(&tar.Header{Name: m.name, Mode: 0600, Size: int64(len(m.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(m.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// expanded converts an archive as a question with the limits would
+func expanded(limits ArchiveLimits, f File) ([]Part, error) {
+	x := &Conversion{expansion: &expansion{limits: limits.withDefaults()}}
+	return x.Convert(context.Background(), f)
+}
+
+func TestExpand(t *testing.T) {
+	inner := tarGzipped(t, member{"c.txt", "gamma"}, member{"d.txt", "delta"})
+	f := File{Name: "outer.zip", Content: zipped(t,
+		member{"a.txt", "alpha"},
+		member{"dir/b.txt", "beta"},
+		member{"__MACOSX/dir/._b.txt", "junk"},
+		member{"blob.bin", "\x00\x01\x02\x03\xfe\xff"},
+		member{"inner.tar.gz", string(inner)},
+	)}
+	parts, err := expanded(ArchiveLimits{}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range parts {
+		names = append(names, p.Name)
+	}
+	want := []string{
+		"outer.zip",
+		"outer.zip/a.txt",
+		"outer.zip/dir/b.txt",
+		"outer.zip/inner.tar.gz",
+		"outer.zip/inner.tar.gz/c.txt",
+		"outer.zip/inner.tar.gz/d.txt",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got parts %q, want %q", names, want)
+	}
+	listing := "files included below:\na.txt\ndir/b.txt\ninner.tar.gz\n\nfiles skipped, being of unsupported types:\nblob.bin"
+	if parts[0].Text != listing {
+		t.Errorf("listed %q, want %q", parts[0].Text, listing)
+	}
+	if parts[3].Text != "files included below:\nc.txt\nd.txt" {
+		t.Errorf("listed nested archive as %q", parts[3].Text)
+	}
+}
+
+func TestExpandLimits(t *testing.T) {
+	// compressed, the nested archive is smaller than its 2000 bytes of members:
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes.Repeat([]byte("a"), 1000))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nested := zipped(t, member{"inner.zip", b.String()})
+	for _, c := range []struct {
+		name   string
+		limits ArchiveLimits
+		f      []byte
+		fails  bool
+	}{
+		{"files", ArchiveLimits{MaxEntries: 3}, zipped(t, member{"a.txt", "a"}, member{"b.txt", "b"}, member{"c.txt", "c"}), false},
+		{"too many files", ArchiveLimits{MaxEntries: 2}, zipped(t, member{"a.txt", "a"}, member{"b.txt", "b"}, member{"c.txt", "c"}), true},
+		{"bytes", ArchiveLimits{MaxSize: 10}, zipped(t, member{"a.txt", "12345"}, member{"b.txt", "67890"}), false},
+		{"too many bytes", ArchiveLimits{MaxSize: 9}, zipped(t, member{"a.txt", "12345"}, member{"b.txt", "67890"}), true},
+		// the nested archive's own bytes aren't counted besides its members':
+		{"nested bytes", ArchiveLimits{MaxSize: 2000}, nested, false},
+		{"too many nested bytes", ArchiveLimits{MaxSize: 1999}, nested, true},
+		{"nested", ArchiveLimits{MaxDepth: 2}, nested, false},
+		{"nested too deep", ArchiveLimits{MaxDepth: 1}, nested, true},
+	} {
+		_, err := expanded(c.limits, File{Name: "x.zip", Content: c.f})
+		switch {
+		case c.fails && !errors.Is(err, ErrArchiveLimit):
+			t.Errorf("%s: got %v, want ErrArchiveLimit", c.name, err)
+		case !c.fails && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
+
+// members are converted with their archive's options
+func TestExpandOptions(t *testing.T) {
+	var got []File
+	x := &Conversion{
+		expansion: &expansion{limits: ArchiveLimits{}.withDefaults()},
+		converters: map[string]Converter{"text/plain": ConverterFunc(func(_ context.Context, _ *Conversion, f File) ([]Part, error) {
+			got = append(got, f)
+			return nil, nil
+		})},
+	}
+	options := client.TranscriptionOptions{Language: "de", Translate: true}
+	f := File{
+		Name:          "x.zip",
+		Content:       zipped(t, member{"a.txt", "a"}, member{"inner.zip", string(zipped(t, member{"b.txt", "b"}))}),
+		Timestamps:    true,
+		Transcription: options,
+	}
+	if _, err := x.Convert(context.Background(), f); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("converted %d members", len(got))
+	}
+	for _, m := range got {
+		if !m.Timestamps || m.Transcription != options {
+			t.Errorf("%s: timestamps %v, transcription %+v", m.Name, m.Timestamps, m.Transcription)
+		}
+	}
+}
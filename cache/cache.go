@@ -0,0 +1,178 @@
+// package cache remembers the results of slow conversions, like transcripts
+// and the text of pdf files, by a hash of what they were converted from, so
+// files attached again aren't converted again
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache stores values by key. implementations are safe for concurrent use.
+type Cache interface {
+	Get(key string) ([]byte, bool) // callers mustn't modify the value
+	Put(key string, value []byte) error
+	Stats() Stats
+}
+
+// Stats counts lookups answered from a cache, or not
+type Stats struct {
+	Hits, Misses int
+}
+
+// Key hashes what a value depends on: its kind, like "transcript", the
+// content it was converted from, and the options of converting it, encoded as
+// json
+func Key(kind string, content []byte, options any) string {
+	o, _ := json.Marshal(options)
+	h := sha256.New()
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write(o)
+	h.Write([]byte{0})
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Memory is a cache of limited size in memory, evicting the least recently used values
+type Memory struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	entries map[string]*list.Element // of *entry
+	order   *list.List               // most recently used first
+	stats   Stats
+}
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+// NewMemory returns a cache holding up to maxBytes of values; if zero, 64MB
+func NewMemory(maxBytes int64) *Memory {
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+	return &Memory{max: maxBytes, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		m.stats.Misses++
+		return nil, false
+	}
+	m.stats.Hits++
+	m.order.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+// Put stores a value, unless it's larger than the whole cache
+func (m *Memory) Put(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.remove(e)
+	}
+	if int64(len(value)) > m.max {
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(&entry{key: key, value: append([]byte(nil), value...)})
+	m.size += int64(len(value))
+	for m.size > m.max {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+func (m *Memory) remove(e *list.Element) {
+	x := m.order.Remove(e).(*entry)
+	delete(m.entries, x.key)
+	m.size -= int64(len(x.value))
+}
+
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *Memory) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// Dir is a cache of files in a directory, shared by processes and kept
+// across runs. nothing is evicted; remove the directory to clear it.
+type Dir struct {
+	path  string
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewDir returns a cache in a directory, creating it if need be
+func NewDir(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	return &Dir{path: path}, nil
+}
+
+// file is where a value is kept, in subdirectories by the key's first
+// characters, so none grows too large. keys not made by Key are hashed, so
+// they can't name files elsewhere.
+func (d *Dir) file(key string) string {
+	if _, err := hex.DecodeString(key); err != nil || len(key) < 3 {
+		key = Key("", []byte(key), nil)
+	}
+	return filepath.Join(d.path, key[:2], key)
+}
+
+// Get returns a stored value; unreadable files are misses
+func (d *Dir) Get(key string) ([]byte, bool) {
+	b, err := os.ReadFile(d.file(key))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.stats.Misses++
+		return nil, false
+	}
+	d.stats.Hits++
+	return b, true
+}
+
+// Put writes a value atomically, so concurrent readers never see part of it
+func (d *Dir) Put(key string, value []byte) error {
+	path := d.file(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (d *Dir) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
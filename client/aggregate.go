@@ -0,0 +1,200 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// aggregator assembles a CompletionResponse, either from a whole response
+// or from stream chunks, so both paths yield identical results
+type aggregator struct {
+	w        io.Writer       // where to stream content as it arrives, if non-nil
+	tools    func(ToolDelta) // where to stream tool calls as they arrive, if non-nil
+	content  strings.Builder
+	refusal  strings.Builder
+	calls    []*FunctionCall
+	byIndex  map[int]*FunctionCall
+	finish   string
+	usage    Usage
+	logprobs []openai.LogProb
+}
+
+func newAggregator(r CompletionRequest) *aggregator {
+	return &aggregator{
+		w:       r.Stream,
+		tools:   r.ToolDeltas,
+		byIndex: make(map[int]*FunctionCall),
+	}
+}
+
+// ToolDelta is a fragment of a tool call, as it arrives
+type ToolDelta struct {
+	Index     int    // of the call within the response
+	ID        string // set when the call starts
+	Name      string // set when the call starts
+	Arguments string // next fragment of the json arguments
+}
+
+// Usage is the token count of a completion
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int // prompt tokens served from the provider's cache
+	TotalTokens      int
+}
+
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + o.PromptTokens,
+		CompletionTokens: u.CompletionTokens + o.CompletionTokens,
+		CachedTokens:     u.CachedTokens + o.CachedTokens,
+		TotalTokens:      u.TotalTokens + o.TotalTokens,
+	}
+}
+
+func (a *aggregator) text(s string) {
+	if len(s) == 0 {
+		return
+	}
+	a.content.WriteString(s)
+	if a.w != nil {
+		fmt.Fprint(a.w, s)
+	}
+}
+
+// toolCall adds to the call at index, starting a new one if needed
+func (a *aggregator) toolCall(index int, id, name, arguments string) {
+	call, ok := a.byIndex[index]
+	if !ok {
+		call = new(FunctionCall)
+		a.byIndex[index] = call
+		a.calls = append(a.calls, call)
+	}
+	if len(id) > 0 {
+		call.ID = id
+	}
+	if len(name) > 0 {
+		call.Name = name
+	}
+	call.Arguments += arguments
+	if a.tools != nil {
+		a.tools(ToolDelta{
+			Index:     index,
+			ID:        call.ID,
+			Name:      name,
+			Arguments: arguments,
+		})
+	}
+}
+
+func (a *aggregator) toolCalls(calls []openai.ToolCall) {
+	for _, c := range calls {
+		var index int
+		switch {
+		case c.Index != nil:
+			index = *c.Index
+		case len(c.ID) > 0 || len(a.calls) == 0:
+			// some servers don't index their calls, so each id starts a new one:
+			index = len(a.calls)
+		default:
+			index = len(a.calls) - 1
+		}
+		a.toolCall(index, c.ID, c.Function.Name, c.Function.Arguments)
+	}
+}
+
+func (a *aggregator) setUsage(u *openai.Usage) {
+	if u == nil {
+		return
+	}
+	a.usage = Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if d := u.PromptTokensDetails; d != nil {
+		a.usage.CachedTokens = d.CachedTokens
+	}
+}
+
+// chunk adds a stream chunk
+func (a *aggregator) chunk(t openai.ChatCompletionStreamResponse) {
+	a.setUsage(t.Usage)
+	for _, c := range t.Choices {
+		if c.Index != 0 {
+			continue
+		}
+		a.text(c.Delta.Content)
+		a.refusal.WriteString(c.Delta.Refusal)
+		a.toolCalls(c.Delta.ToolCalls)
+		if len(c.FinishReason) > 0 {
+			a.finish = string(c.FinishReason)
+		}
+		if c.Logprobs != nil {
+			for _, p := range c.Logprobs.Content {
+				a.logprobs = append(a.logprobs, streamLogprob(p))
+			}
+		}
+	}
+}
+
+// response adds a whole, non-streamed response
+func (a *aggregator) response(r openai.ChatCompletionResponse) error {
+	if len(r.Choices) == 0 {
+		return fmt.Errorf("no choices")
+	}
+	a.setUsage(&r.Usage)
+	c := r.Choices[0]
+	a.text(c.Message.Content)
+	a.refusal.WriteString(c.Message.Refusal)
+	for i, call := range c.Message.ToolCalls {
+		a.toolCall(i, call.ID, call.Function.Name, call.Function.Arguments)
+	}
+	a.finish = string(c.FinishReason)
+	if c.LogProbs != nil {
+		a.logprobs = append(a.logprobs, c.LogProbs.Content...)
+	}
+	return nil
+}
+
+func (a *aggregator) result() *CompletionResponse {
+	for _, call := range a.calls {
+		if len(call.Arguments) == 0 {
+			call.Arguments = "{}"
+		}
+	}
+	return &CompletionResponse{
+		FinishReason:  a.finish,
+		Content:       a.content.String(),
+		Refusal:       a.refusal.String(),
+		FunctionCalls: a.calls,
+		Usage:         a.usage,
+		Logprobs:      a.logprobs,
+	}
+}
+
+func streamLogprob(p openai.ChatCompletionTokenLogprob) openai.LogProb {
+	bytes := func(b []int64) []byte {
+		var out []byte
+		for _, x := range b {
+			out = append(out, byte(x))
+		}
+		return out
+	}
+	lp := openai.LogProb{
+		Token:   p.Token,
+		LogProb: p.Logprob,
+		Bytes:   bytes(p.Bytes),
+	}
+	for _, t := range p.TopLogprobs {
+		lp.TopLogProbs = append(lp.TopLogProbs, openai.TopLogProbs{
+			Token:   t.Token,
+			LogProb: t.Logprob,
+			Bytes:   bytes(t.Bytes),
+		})
+	}
+	return lp
+}
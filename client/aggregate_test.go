@@ -0,0 +1,169 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// aggregations are responses recorded both streamed, as the data of each
+// server-sent event, and whole
+var aggregations = []struct {
+	name   string
+	chunks []string
+	whole  string
+	want   CompletionResponse
+}{
+	{
+		name: "content",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":", world"}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hello, world"},"finish_reason":"stop"}]}`,
+		want:  CompletionResponse{FinishReason: "stop", Content: "Hello, world"},
+	},
+	{
+		name: "tool calls by index",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"a","type":"function","function":{"name":"add","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"x\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"b","type":"function","function":{"name":"sub","arguments":"{\"y\":2}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":2,"id":"c","type":"function","function":{"name":"now"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[
+			{"id":"a","type":"function","function":{"name":"add","arguments":"{\"x\":1}"}},
+			{"id":"b","type":"function","function":{"name":"sub","arguments":"{\"y\":2}"}},
+			{"id":"c","type":"function","function":{"name":"now","arguments":""}}]},"finish_reason":"tool_calls"}]}`,
+		want: CompletionResponse{FinishReason: "tool_calls", FunctionCalls: []*FunctionCall{
+			{ID: "a", Name: "add", Arguments: `{"x":1}`},
+			{ID: "b", Name: "sub", Arguments: `{"y":2}`},
+			{ID: "c", Name: "now", Arguments: "{}"},
+		}},
+	},
+	{
+		name: "tool calls without index",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"id":"a","type":"function","function":{"name":"add","arguments":"{\"x\""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"function":{"arguments":":1}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"id":"b","type":"function","function":{"name":"sub","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[
+			{"id":"a","type":"function","function":{"name":"add","arguments":"{\"x\":1}"}},
+			{"id":"b","type":"function","function":{"name":"sub","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+		want: CompletionResponse{FinishReason: "tool_calls", FunctionCalls: []*FunctionCall{
+			{ID: "a", Name: "add", Arguments: `{"x":1}`},
+			{ID: "b", Name: "sub", Arguments: "{}"},
+		}},
+	},
+	{
+		name: "refusal",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{"refusal":"I can't"}}]}`,
+			`{"choices":[{"index":0,"delta":{"refusal":" help with that."}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant","refusal":"I can't help with that."},"finish_reason":"stop"}]}`,
+		want:  CompletionResponse{FinishReason: "stop", Refusal: "I can't help with that."},
+	},
+	{
+		name: "usage only chunk",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{"content":"ok"}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"prompt_tokens_details":{"cached_tokens":4}}}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"prompt_tokens_details":{"cached_tokens":4}}}`,
+		want: CompletionResponse{FinishReason: "stop", Content: "ok", Usage: Usage{PromptTokens: 10, CompletionTokens: 2, CachedTokens: 4, TotalTokens: 12}},
+	},
+	{
+		name: "length",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{"content":"cut"}}]}`,
+			`{"choices":[{"index":1,"delta":{"content":" other choice"}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant","content":"cut"},"finish_reason":"length"}]}`,
+		want:  CompletionResponse{FinishReason: "length", Content: "cut"},
+	},
+	{
+		name: "content filter",
+		chunks: []string{
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"content_filter"}]}`,
+		},
+		whole: `{"choices":[{"index":0,"message":{"role":"assistant"},"finish_reason":"content_filter"}]}`,
+		want:  CompletionResponse{FinishReason: "content_filter"},
+	},
+}
+
+func TestAggregate(t *testing.T) {
+	for _, c := range aggregations {
+		t.Run(c.name, func(t *testing.T) {
+			var streamed strings.Builder
+			var deltas []ToolDelta
+			a := newAggregator(CompletionRequest{Stream: &streamed, ToolDeltas: func(d ToolDelta) { deltas = append(deltas, d) }})
+			for _, s := range c.chunks {
+				var chunk openai.ChatCompletionStreamResponse
+				if err := json.Unmarshal([]byte(s), &chunk); err != nil {
+					t.Fatalf("chunk %s: %v", s, err)
+				}
+				a.chunk(chunk)
+			}
+			got := a.result()
+			if !reflect.DeepEqual(*got, c.want) {
+				t.Errorf("streamed: got %+v, want %+v", *got, c.want)
+			}
+			if streamed.String() != c.want.Content {
+				t.Errorf("streamed %q, want %q", streamed.String(), c.want.Content)
+			}
+			// the deltas reassemble the calls:
+			calls := make(map[int]*FunctionCall)
+			for _, d := range deltas {
+				if calls[d.Index] == nil {
+					calls[d.Index] = &FunctionCall{ID: d.ID}
+				}
+				calls[d.Index].Name += d.Name
+				calls[d.Index].Arguments += d.Arguments
+			}
+			if len(calls) != len(c.want.FunctionCalls) {
+				t.Errorf("deltas of %d calls, want %d", len(calls), len(c.want.FunctionCalls))
+			}
+			for i, want := range c.want.FunctionCalls {
+				call := calls[i]
+				if call != nil && len(call.Arguments) == 0 {
+					call.Arguments = "{}" // as the result defaults them
+				}
+				if call == nil || *call != *want {
+					t.Errorf("deltas of call %d: got %+v, want %+v", i, call, want)
+				}
+			}
+
+			var whole openai.ChatCompletionResponse
+			if err := json.Unmarshal([]byte(c.whole), &whole); err != nil {
+				t.Fatal(err)
+			}
+			b := newAggregator(CompletionRequest{})
+			if err := b.response(whole); err != nil {
+				t.Fatal(err)
+			}
+			if w := b.result(); !reflect.DeepEqual(w, got) {
+				t.Errorf("whole %+v differs from streamed %+v", *w, *got)
+			}
+		})
+	}
+}
+
+func TestAggregateNoChoices(t *testing.T) {
+	if err := newAggregator(CompletionRequest{}).response(openai.ChatCompletionResponse{}); err == nil {
+		t.Error("no error for a response without choices")
+	}
+}
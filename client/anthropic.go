@@ -0,0 +1,407 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/vincent-petithory/dataurl"
+)
+
+const (
+	anthropicURL       = "https://api.anthropic.com/v1"
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096 // required by the api, so we need some default
+)
+
+// anthropic speaks the anthropic messages api
+type anthropic struct {
+	key     string
+	baseURL string
+	model   string // default model, if the request has none
+	http    *http.Client
+}
+
+func newAnthropic(c Config, httpClient *http.Client) *anthropic {
+	p := &anthropic{
+		key:     c.Key,
+		baseURL: strings.TrimSuffix(c.BaseURL, "/"),
+		model:   c.Model,
+		http:    httpClient,
+	}
+	if len(p.baseURL) == 0 {
+		p.baseURL = anthropicURL
+	}
+	if len(p.model) == 0 {
+		m, _ := Default(AnthropicProvider)
+		p.model = m.Wire()
+	}
+	return p
+}
+
+func (p *anthropic) Name() string {
+	return AnthropicProvider
+}
+
+func (p *anthropic) DefaultModel() string {
+	return p.model
+}
+
+func (p *anthropic) TranscribeAV(context.Context, TranscriptionRequest) (string, error) {
+	return "", fmt.Errorf("%s transcription: %w", AnthropicProvider, ErrUnsupported)
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float32            `json:"temperature"`
+	TopP        float32            `json:"top_p"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *anthropicImage `json:"source,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicImage struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicEvent is any of the server-sent events of a stream
+type anthropicEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *anthropicResponse `json:"message"`
+	ContentBlock *anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *anthropicError `json:"error"`
+}
+
+func (p *anthropic) Complete(ctx context.Context, r CompletionRequest) (*CompletionResponse, error) {
+	req, err := p.request(r)
+	if err != nil {
+		return nil, err
+	}
+	// the api has no json mode, so we prefill the answer instead:
+	prefill := isJSON(r.Format) && len(req.Tools) == 0
+	if prefill {
+		req.Messages = appendAnthropic(req.Messages, anthropicMessage{
+			Role:    "assistant",
+			Content: []anthropicBlock{{Type: "text", Text: "{"}},
+		})
+	}
+	req.Stream = r.Stream != nil
+	body, err := p.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	a := newAggregator(r)
+	if prefill {
+		a.text("{")
+	}
+	if r.Stream == nil {
+		var ar anthropicResponse
+		if err := json.NewDecoder(body).Decode(&ar); err != nil {
+			return nil, err
+		}
+		var calls int
+		for _, b := range ar.Content {
+			switch b.Type {
+			case "text":
+				a.text(b.Text)
+			case "tool_use":
+				a.toolCall(calls, b.ID, b.Name, string(b.Input))
+				calls++
+			}
+		}
+		a.finish = anthropicFinishReason(ar.StopReason)
+		a.anthropicUsage(ar.Usage)
+	} else if err := p.stream(ctx, body, a); err != nil {
+		return nil, err
+	}
+	return a.result(), nil
+}
+
+func (p *anthropic) stream(ctx context.Context, body io.Reader, a *aggregator) error {
+	s := bufio.NewScanner(body)
+	s.Buffer(nil, 1<<20)
+	// blocks are indexed among all content, text included, and calls among calls:
+	calls := make(map[int]int) // call index by block index
+	for s.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, ok := strings.CutPrefix(s.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var e anthropicEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return err
+		}
+		switch e.Type {
+		case "message_start":
+			if e.Message != nil {
+				a.anthropicUsage(e.Message.Usage)
+			}
+		case "content_block_start":
+			if b := e.ContentBlock; b != nil && b.Type == "tool_use" {
+				calls[e.Index] = len(calls)
+				a.toolCall(calls[e.Index], b.ID, b.Name, "")
+			}
+		case "content_block_delta":
+			switch e.Delta.Type {
+			case "text_delta":
+				a.text(e.Delta.Text)
+			case "input_json_delta":
+				if i, ok := calls[e.Index]; ok {
+					a.toolCall(i, "", "", e.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			a.finish = anthropicFinishReason(e.Delta.StopReason)
+			if e.Usage != nil {
+				a.anthropicUsage(*e.Usage)
+			}
+		case "error":
+			if e.Error != nil {
+				return &APIError{Provider: AnthropicProvider, Type: e.Error.Type, Message: e.Error.Message}
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Err()
+}
+
+// anthropicUsage updates usage, which the api reports piecemeal when streaming
+func (a *aggregator) anthropicUsage(u anthropicUsage) {
+	// unlike openai, input tokens exclude the cached ones:
+	if prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens; prompt > 0 {
+		a.usage.PromptTokens = prompt
+		a.usage.CachedTokens = u.CacheReadInputTokens
+	}
+	if u.OutputTokens > 0 {
+		a.usage.CompletionTokens = u.OutputTokens
+	}
+	a.usage.TotalTokens = a.usage.PromptTokens + a.usage.CompletionTokens
+}
+
+func (p *anthropic) post(ctx context.Context, r *anthropicRequest) (io.ReadCloser, error) {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/messages", bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("x-api-key", p.key)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		apiError := &APIError{Provider: AnthropicProvider, StatusCode: resp.StatusCode}
+		var e struct {
+			Error anthropicError `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err == nil {
+			apiError.Type, apiError.Message = e.Error.Type, e.Error.Message
+		} else {
+			apiError.Message = resp.Status
+		}
+		return nil, apiError
+	}
+	return resp.Body, nil
+}
+
+// request translates the openai-style request into anthropic's wire format
+func (p *anthropic) request(r CompletionRequest) (*anthropicRequest, error) {
+	model := r.Model.Wire()
+	if len(model) == 0 {
+		model = p.model
+	}
+	req := &anthropicRequest{
+		Model:       model,
+		MaxTokens:   r.MaxTokens,
+		Temperature: 1.0,
+		TopP:        1,
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = anthropicMaxTokens
+	}
+	for _, t := range r.Tools {
+		if t.Function == nil {
+			continue
+		}
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	var system []string
+	for _, m := range r.Messages {
+		// leading system messages go to the dedicated field, later ones become user text:
+		if m.Role == openai.ChatMessageRoleSystem && len(req.Messages) == 0 && len(m.MultiContent) == 0 {
+			system = append(system, m.Content)
+			continue
+		}
+		var am anthropicMessage
+		switch m.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleUser:
+			am.Role = "user"
+		case openai.ChatMessageRoleAssistant:
+			am.Role = "assistant"
+		case openai.ChatMessageRoleTool:
+			am.Role = "user"
+			am.Content = append(am.Content, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   m.Content,
+			})
+			req.Messages = appendAnthropic(req.Messages, am)
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported role: %q", m.Role)
+		}
+		if len(m.Content) > 0 {
+			am.Content = append(am.Content, anthropicBlock{Type: "text", Text: m.Content})
+		}
+		for _, part := range m.MultiContent {
+			switch part.Type {
+			case openai.ChatMessagePartTypeText:
+				am.Content = append(am.Content, anthropicBlock{Type: "text", Text: part.Text})
+			case openai.ChatMessagePartTypeImageURL:
+				if part.ImageURL == nil {
+					continue
+				}
+				u, err := dataurl.DecodeString(part.ImageURL.URL)
+				if err != nil {
+					return nil, fmt.Errorf("%s only supports data url images: %w", AnthropicProvider, err)
+				}
+				am.Content = append(am.Content, anthropicBlock{
+					Type: "image",
+					Source: &anthropicImage{
+						Type:      "base64",
+						MediaType: u.ContentType(),
+						Data:      base64.StdEncoding.EncodeToString(u.Data),
+					},
+				})
+			default:
+				return nil, fmt.Errorf("unsupported message part: %q", part.Type)
+			}
+		}
+		for _, call := range m.ToolCalls {
+			input := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			am.Content = append(am.Content, anthropicBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Function.Name,
+				Input: input,
+			})
+		}
+		if len(am.Content) == 0 {
+			continue
+		}
+		req.Messages = appendAnthropic(req.Messages, am)
+	}
+	req.System = strings.Join(system, "\n\n")
+	if isJSON(r.Format) {
+		req.System = strings.TrimSpace(req.System + "\n\nrespond only with a single json object.")
+	}
+	return req, nil
+}
+
+func isJSON(f ResponseFormat) bool {
+	return f == JSONResponse || f == JSONSchemaResponse
+}
+
+// appendAnthropic merges consecutive messages of the same role, since roles must alternate
+func appendAnthropic(list []anthropicMessage, m anthropicMessage) []anthropicMessage {
+	if n := len(list); n > 0 && list[n-1].Role == m.Role {
+		list[n-1].Content = append(list[n-1].Content, m.Content...)
+		return list
+	}
+	return append(list, m)
+}
+
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return string(openai.FinishReasonStop)
+	case "tool_use":
+		return string(openai.FinishReasonToolCalls)
+	case "max_tokens":
+		return string(openai.FinishReasonLength)
+	default:
+		return stopReason
+	}
+}
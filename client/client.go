@@ -1,18 +1,45 @@
 package client
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/cache"
 )
 
 type Interface interface {
+	Provider() string // name of the provider, e.g. "openai"
 	TranscribeAV(TranscriptionRequest) (string, error)
+	TranscribeAVContext(context.Context, TranscriptionRequest) (string, error)
 	Complete(CompletionRequest) (*CompletionResponse, error)
-	OpenAI
+	CompleteContext(context.Context, CompletionRequest) (*CompletionResponse, error)
 }
 
+// Provider is a vendor backend, translating requests into its own wire format
+type Provider interface {
+	Name() string
+	Complete(context.Context, CompletionRequest) (*CompletionResponse, error)
+	TranscribeAV(context.Context, TranscriptionRequest) (string, error)
+}
+
+// Embedder is implemented by clients and providers that can embed text
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// DefaultModeler is implemented by clients and providers that complete
+// requests naming no model with a default one
+type DefaultModeler interface {
+	DefaultModel() string // as sent on the wire
+}
+
+// OpenAI is the subset of go-openai's client used by the openai provider
 type OpenAI interface {
 	CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
 	CreateChatCompletionStream(context.Context, openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error)
@@ -23,18 +50,241 @@ type OpenAI interface {
 	CreateSpeech(context.Context, openai.CreateSpeechRequest) (openai.RawResponse, error)
 }
 
+// ErrUnsupported is returned for functionality a provider lacks
+var ErrUnsupported = errors.New("unsupported by provider")
+
+// APIError is an error response from a provider's http api
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s error, status %d: %s: %s", e.Provider, e.StatusCode, e.Type, e.Message)
+}
+
+// names of the built-in providers
+const (
+	OpenAIProvider     = "openai"
+	AnthropicProvider  = "anthropic"
+	OllamaProvider     = "ollama"
+	CompatibleProvider = "openai-compatible" // any other openai-compatible server, like llama.cpp's
+)
+
+// Config selects and configures a provider
+type Config struct {
+	Provider   string       // one of the *Provider names, defaults to openai
+	Key        string       // api key, if the provider needs one
+	BaseURL    string       // overrides the provider's default endpoint, including any "/v1"
+	Model      string       // wire name of the model for requests without one
+	Embedding  string       // embedding model, if not the provider's default
+	HTTPClient *http.Client // if nil, http.DefaultClient
+	Retry      RetryPolicy  // for failed completions
+	Limiter    *RateLimiter // if non-nil, paces completions
+	// splits audio too large for one transcription upload:
+	Segmentation Segmentation
+	// if non-nil, remembers transcripts, so files sent again aren't transcribed again:
+	Cache cache.Cache
+}
+
 type client struct {
-	*openai.Client
+	p       Provider
+	retry   RetryPolicy
+	limiter *RateLimiter
+	cache   cache.Cache
+}
+
+func (c client) Provider() string {
+	return c.p.Name()
 }
 
 func (c client) TranscribeAV(r TranscriptionRequest) (string, error) {
-	return TranscribeAV(c, r)
+	return c.TranscribeAVContext(context.Background(), r)
+}
+
+func (c client) TranscribeAVContext(ctx context.Context, r TranscriptionRequest) (string, error) {
+	key := c.transcriptKey("transcript", r)
+	if b, ok := c.cached(key); ok {
+		return string(b), nil
+	}
+	t, err := c.p.TranscribeAV(ctx, r)
+	if err != nil {
+		return "", err
+	}
+	c.remember(key, []byte(t))
+	return t, nil
+}
+
+// Transcribe transcribes with segment timestamps, if the provider can
+func (c client) Transcribe(ctx context.Context, r TranscriptionRequest) (*Transcription, error) {
+	t, ok := c.p.(Transcriber)
+	if !ok {
+		return nil, fmt.Errorf("%s timestamped transcription: %w", c.p.Name(), ErrUnsupported)
+	}
+	key := c.transcriptKey("timed transcript", r)
+	if b, ok := c.cached(key); ok {
+		var out Transcription
+		if json.Unmarshal(b, &out) == nil {
+			return &out, nil
+		}
+	}
+	out, err := t.Transcribe(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := json.Marshal(out); err == nil {
+		c.remember(key, b)
+	}
+	return out, nil
+}
+
+// transcriptKey is the cache key of a transcription, by the file and all that
+// changes its transcript
+func (c client) transcriptKey(kind string, r TranscriptionRequest) string {
+	if c.cache == nil {
+		return ""
+	}
+	return cache.Key(kind, r.File.Content, struct {
+		Provider, ContentType, Prompt string
+		Options                       TranscriptionOptions
+	}{c.p.Name(), r.File.ContentType, r.Prompt, r.Options})
+}
+
+func (c client) cached(key string) ([]byte, bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+	return c.cache.Get(key)
+}
+
+// remember caches a value, if there's a cache; failing to is no failure
+func (c client) remember(key string, value []byte) {
+	if c.cache != nil {
+		c.cache.Put(key, value)
+	}
+}
+
+func (c client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e, ok := c.p.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("%s embeddings: %w", c.p.Name(), ErrUnsupported)
+	}
+	return e.Embed(ctx, texts)
+}
+
+// DefaultModel is the provider's model for requests naming none, if known
+func (c client) DefaultModel() string {
+	if d, ok := c.p.(DefaultModeler); ok {
+		return d.DefaultModel()
+	}
+	return ""
 }
 
 func (c client) Complete(r CompletionRequest) (*CompletionResponse, error) {
-	return Complete(c, r)
+	return c.CompleteContext(context.Background(), r)
+}
+
+// CompleteContext retries per the client's policy, unless output was already
+// streamed, and paces each attempt with its rate limiter
+func (c client) CompleteContext(ctx context.Context, r CompletionRequest) (*CompletionResponse, error) {
+	policy := c.retry.withDefaults()
+	for attempt := 1; ; attempt++ {
+		estimate := estimateTokens(r)
+		if err := c.limiter.Wait(ctx, estimate); err != nil {
+			return nil, err
+		}
+		after := new(retryAfter)
+		watch := new(streamWatch)
+		resp, err := c.p.Complete(context.WithValue(ctx, retryAfterKey{}, after), watch.watch(r))
+		if err == nil {
+			if resp.Usage.TotalTokens > 0 {
+				c.limiter.Adjust(resp.Usage.TotalTokens - estimate)
+			}
+			return resp, nil
+		}
+		if attempt >= policy.MaxAttempts || watch.done() || ctx.Err() != nil || !policy.Retryable(err) {
+			if attempt > 1 {
+				return nil, fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return nil, err
+		}
+		if err := sleep(ctx, policy.delay(attempt, after.get())); err != nil {
+			return nil, err
+		}
+	}
 }
 
+// New returns an openai client
 func New(key string) (Interface, error) {
-	return client{openai.NewClient(strings.TrimSpace(key))}, nil
+	return NewFromConfig(Config{Provider: OpenAIProvider, Key: key})
+}
+
+// NewFromProvider wraps any provider as an Interface, with the default retry policy
+func NewFromProvider(p Provider) Interface {
+	return client{p: p}
+}
+
+// NewFromConfig returns a client for the configured provider
+func NewFromConfig(c Config) (Interface, error) {
+	c.Key = strings.TrimSpace(c.Key)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	httpClient = withRetryAfter(httpClient)
+	openaiConfig := func(defaultURL string) openai.ClientConfig {
+		config := openai.DefaultConfig(c.Key)
+		if len(defaultURL) > 0 {
+			config.BaseURL = defaultURL
+		}
+		if len(c.BaseURL) > 0 {
+			config.BaseURL = c.BaseURL
+		}
+		config.HTTPClient = httpClient
+		return config
+	}
+	var p Provider
+	switch c.Provider {
+	case OpenAIProvider, "":
+		p = &openAI{
+			name:         OpenAIProvider,
+			c:            openai.NewClientWithConfig(openaiConfig("")),
+			model:        c.Model,
+			embedding:    cmp.Or(c.Embedding, string(openai.SmallEmbedding3)),
+			segmentation: c.Segmentation,
+		}
+	case OllamaProvider:
+		model := c.Model
+		if len(model) == 0 {
+			m, _ := Default(OllamaProvider)
+			model = m.Wire()
+		}
+		p = &openAI{
+			name:      OllamaProvider,
+			c:         openai.NewClientWithConfig(openaiConfig("http://localhost:11434/v1")),
+			model:     model,
+			embedding: cmp.Or(c.Embedding, "nomic-embed-text"),
+		}
+	case CompatibleProvider:
+		if len(c.BaseURL) == 0 {
+			return nil, fmt.Errorf("%s provider needs a base url", c.Provider)
+		}
+		if len(c.Model) == 0 {
+			return nil, fmt.Errorf("%s provider needs a model", c.Provider)
+		}
+		p = &openAI{
+			name:         CompatibleProvider,
+			c:            openai.NewClientWithConfig(openaiConfig("")),
+			model:        c.Model,
+			embedding:    c.Embedding,
+			segmentation: c.Segmentation,
+		}
+	case AnthropicProvider:
+		p = newAnthropic(c, httpClient)
+	default:
+		return nil, fmt.Errorf("unknown provider: %q", c.Provider)
+	}
+	return client{p: p, retry: c.Retry, limiter: c.Limiter, cache: c.Cache}, nil
 }
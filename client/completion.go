@@ -1,7 +1,6 @@
 package client
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -14,18 +13,26 @@ import (
 )
 
 type CompletionRequest struct {
-	Model     ModelName
+	Model     Model // the zero Model means the provider's default
 	Format    ResponseFormat
-	MaxTokens int       // 0 means no limit, except for GPT4Vision, which has a small default limit
+	MaxTokens int       // 0 means the model's default limit
 	Stream    io.Writer // if nil, then no streaming
 	Tools     []openai.Tool
 	Messages  []openai.ChatCompletionMessage
+	Schema    json.Marshaler // for JSONSchemaResponse, typically a strict *jsonschema.Schema
+	Logprobs  int            // if positive, return log probabilities with this many alternatives per token
+	// if non-nil while streaming, called with each fragment of the tool calls:
+	ToolDeltas func(ToolDelta)
 }
 
 type CompletionResponse struct {
 	FinishReason  string
 	Content       string
+	Refusal       string // set if the model refused to answer
 	FunctionCalls []*FunctionCall
+	Usage         Usage
+	Logprobs      []openai.LogProb // if requested
+	Replayed      bool             // from a response cache, so with zero usage, as nothing was spent
 }
 
 //go:generate stringer -type=ResponseFormat
@@ -36,28 +43,24 @@ const (
 	NoneSpecified
 	JSONResponse
 	TextResponse
-)
-
-//go:generate stringer -type=ModelName
-type ModelName int
-
-const (
-	_ ModelName = iota
-	DefaultModel
-	GPT4Turbo
-	GPT4Vision
+	JSONSchemaResponse // strict structured output, per CompletionRequest.Schema
 )
 
 func Complete(c OpenAI, r CompletionRequest) (*CompletionResponse, error) {
-	var model string
-	switch r.Model {
-	case DefaultModel:
-		model = "gpt-4-turbo"
-	case GPT4Turbo, GPT4Vision:
-		model = "gpt-4-turbo-2024-04-09"
-	default:
-		return nil, fmt.Errorf("unknown model: %d", r.Model)
+	return CompleteContext(context.Background(), c, r)
+}
+
+// CompleteContext is like Complete, but aborts when ctx is done
+func CompleteContext(ctx context.Context, c OpenAI, r CompletionRequest) (*CompletionResponse, error) {
+	model := r.Model.Wire()
+	if len(model) == 0 {
+		m, _ := Default(OpenAIProvider)
+		model = m.Wire()
 	}
+	return complete(ctx, c, model, r)
+}
+
+func complete(ctx context.Context, c OpenAI, model string, r CompletionRequest) (*CompletionResponse, error) {
 	req := openai.ChatCompletionRequest{
 		Model:       model,
 		Messages:    r.Messages,
@@ -66,6 +69,10 @@ func Complete(c OpenAI, r CompletionRequest) (*CompletionResponse, error) {
 		TopP:        1,
 		Tools:       r.Tools,
 	}
+	if r.Logprobs > 0 {
+		req.LogProbs = true
+		req.TopLogProbs = r.Logprobs
+	}
 	switch r.Format {
 	case NoneSpecified:
 	case JSONResponse:
@@ -76,102 +83,79 @@ func Complete(c OpenAI, r CompletionRequest) (*CompletionResponse, error) {
 		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeText,
 		}
+	case JSONSchemaResponse:
+		if r.Schema == nil {
+			return nil, fmt.Errorf("%s needs a schema", r.Format)
+		}
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "answer",
+				Schema: r.Schema,
+				Strict: true,
+			},
+		}
 	default:
 		return nil, fmt.Errorf("unknown format: %d", r.Format)
 	}
-	// TODO: unify stream-or-not processing, by aggregating
-	// stream bits into an openai.ChatCompletionResponse,
-	// not processing them specially:
+	a := newAggregator(r)
 	if r.Stream == nil {
-		// TODO: need to handle functions here
-		resp, err := c.CreateChatCompletion(context.Background(), req)
+		resp, err := c.CreateChatCompletion(ctx, req)
 		if err != nil {
+			return nil, tokensError(err)
+		}
+		if err := a.response(resp); err != nil {
 			return nil, err
 		}
-		return &CompletionResponse{
-			FinishReason: string(resp.Choices[0].FinishReason),
-			Content:      resp.Choices[0].Message.Content,
-		}, nil
-	} else {
-		req.Stream = true
-		resp, err := c.CreateChatCompletionStream(context.Background(), req)
-		if err != nil {
+		return a.result(), nil
+	}
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	resp, err := c.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, tokensError(err)
+	}
+	defer resp.Close()
+	for {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
-		defer resp.Close()
-		var calls []*FunctionCall
-		content := new(bytes.Buffer)
-		contentW := io.MultiWriter(r.Stream, content)
-		var finishReason string
-		for {
-			t, err := resp.Recv()
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				var apiError *openai.APIError
-				if errors.As(err, &apiError) {
-					p := regexp.MustCompile(`(\d+) tokens`)
-					if p.MatchString(apiError.Message) {
-						m := p.FindStringSubmatch(apiError.Message)
-						tokens, convError := strconv.ParseUint(m[1], 10, 64)
-						if convError != nil {
-							return nil, convError
-						}
-						err = fmt.Errorf("total tokens = %d; error = %w", tokens, err)
-					}
-					return nil, err
-				}
-				return nil, err
-			}
-			if false {
-				buf, err := json.MarshalIndent(t, "", "  ")
-				if err != nil {
-					return nil, err
-				}
-				fmt.Printf("\nresponse: %s\n", string(buf))
-			}
-			choices := t.Choices
-			if len(choices) == 0 {
-				return nil, fmt.Errorf("no choices")
-			}
-			firstChoice := choices[0]
-			finishReason = string(firstChoice.FinishReason)
-			fmt.Fprint(contentW, firstChoice.Delta.Content)
-			if len(firstChoice.Delta.ToolCalls) > 0 {
-				first := firstChoice.Delta.ToolCalls[0]
-				if i := first.Index; i != nil {
-					if *i >= len(calls) {
-						calls = append(calls, &FunctionCall{
-							w: new(bytes.Buffer),
-						})
-					}
-					call := calls[*i]
-					if len(first.ID) > 0 {
-						call.ID = first.ID
-					}
-					if first.Type == "function" && len(first.Function.Name) > 0 {
-						fmt.Printf("\nfunction: %s\nparameters: ", first.Function.Name)
-						call.Name = first.Function.Name
-					}
-					call.Arguments += first.Function.Arguments
-					fmt.Fprintf(r.Stream, first.Function.Arguments)
-				}
-			}
+		t, err := resp.Recv()
+		if err == io.EOF {
+			break
+		} else if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		} else if err != nil {
+			return nil, tokensError(err)
 		}
-		fmt.Fprintln(contentW)
-		return &CompletionResponse{
-			FinishReason:  finishReason,
-			Content:       content.String(),
-			FunctionCalls: calls,
-		}, nil
+		a.chunk(t)
 	}
+	return a.result(), nil
 }
 
+// tokensError adds the token count to errors mentioning one, like exceeding the context window
+func tokensError(err error) error {
+	var apiError *openai.APIError
+	if !errors.As(err, &apiError) {
+		return err
+	}
+	m := tokensPattern.FindStringSubmatch(apiError.Message)
+	if m == nil {
+		return err
+	}
+	tokens, convError := strconv.ParseUint(m[1], 10, 64)
+	if convError != nil {
+		return convError
+	}
+	return fmt.Errorf("total tokens = %d; error = %w", tokens, err)
+}
+
+var tokensPattern = regexp.MustCompile(`(\d+) tokens`)
+
 type FunctionCall struct {
 	ID        string
 	Name      string
 	Arguments string
-	w         *bytes.Buffer
 }
 
 func (f FunctionCall) String() string {
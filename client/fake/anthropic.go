@@ -0,0 +1,121 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Anthropic returns a fake of anthropic's messages api
+func Anthropic(replies ...Reply) *Server {
+	return newServer(replies, func(s *Server, mux *http.ServeMux) {
+		mux.Handle("POST /v1/messages", s.handle(anthropicMessages, anthropicError))
+	})
+}
+
+func anthropicError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    "fake_error",
+			"message": message,
+		},
+	})
+}
+
+func anthropicStopReason(reply Reply) string {
+	if len(reply.ToolCalls) > 0 {
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+// prefill returns the text of a trailing assistant message, which the api continues from
+func prefill(body []byte) string {
+	var r struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(body, &r)
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == "assistant" {
+		var text string
+		for _, c := range r.Messages[n-1].Content {
+			text += c.Text
+		}
+		return text
+	}
+	return ""
+}
+
+func anthropicMessages(w http.ResponseWriter, r *http.Request, body []byte, reply Reply) {
+	reply.Content = strings.TrimPrefix(reply.Content, prefill(body))
+	prompt, completion := tokens(body, reply)
+	var content []map[string]any
+	if len(reply.Content) > 0 {
+		content = append(content, map[string]any{"type": "text", "text": reply.Content})
+	}
+	for _, c := range reply.ToolCalls {
+		content = append(content, map[string]any{
+			"type":  "tool_use",
+			"id":    c.ID,
+			"name":  c.Name,
+			"input": json.RawMessage(c.Arguments),
+		})
+	}
+	if !isStream(body) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"id":          "fake",
+			"type":        "message",
+			"role":        "assistant",
+			"content":     content,
+			"stop_reason": anthropicStopReason(reply),
+			"usage":       map[string]any{"input_tokens": prompt, "output_tokens": completion},
+		})
+		return
+	}
+	emit := sse(w)
+	emit("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":      "fake",
+			"type":    "message",
+			"role":    "assistant",
+			"content": []any{},
+			"usage":   map[string]any{"input_tokens": prompt, "output_tokens": 1},
+		},
+	})
+	index := 0
+	block := func(start map[string]any, deltas []map[string]any) {
+		emit("content_block_start", map[string]any{"type": "content_block_start", "index": index, "content_block": start})
+		for _, d := range deltas {
+			emit("content_block_delta", map[string]any{"type": "content_block_delta", "index": index, "delta": d})
+		}
+		emit("content_block_stop", map[string]any{"type": "content_block_stop", "index": index})
+		index++
+	}
+	if len(reply.Content) > 0 {
+		var deltas []map[string]any
+		for _, c := range chunks(reply.Content) {
+			deltas = append(deltas, map[string]any{"type": "text_delta", "text": c})
+		}
+		block(map[string]any{"type": "text", "text": ""}, deltas)
+	}
+	drop(reply)
+	for _, c := range reply.ToolCalls {
+		var deltas []map[string]any
+		for _, a := range chunks(c.Arguments) {
+			deltas = append(deltas, map[string]any{"type": "input_json_delta", "partial_json": a})
+		}
+		block(map[string]any{"type": "tool_use", "id": c.ID, "name": c.Name, "input": map[string]any{}}, deltas)
+	}
+	emit("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": anthropicStopReason(reply)},
+		"usage": map[string]any{"output_tokens": completion},
+	})
+	emit("message_stop", map[string]any{"type": "message_stop"})
+}
@@ -0,0 +1,68 @@
+package fake
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Dimensions of the fake embeddings
+const Dimensions = 64
+
+// Embed is the fake embedding of text: its hashed bag of words, normalized,
+// so texts sharing words are similar. embeddings aren't scripted replies.
+func Embed(text string) []float32 {
+	v := make([]float32, Dimensions)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		v[h.Sum32()%Dimensions]++
+	}
+	var norm float64
+	for _, x := range v {
+		norm += float64(x * x)
+	}
+	if norm > 0 {
+		for i := range v {
+			v[i] /= float32(math.Sqrt(norm))
+		}
+	}
+	return v
+}
+
+func openaiEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+		Model string   `json:"model"`
+	}
+	buf, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(buf, &req)
+	}
+	if err != nil {
+		openaiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := openai.EmbeddingResponse{
+		Object: "list",
+		Model:  openai.EmbeddingModel(req.Model),
+	}
+	for i, text := range req.Input {
+		resp.Data = append(resp.Data, openai.Embedding{
+			Object:    "embedding",
+			Embedding: Embed(text),
+			Index:     i,
+		})
+		resp.Usage.PromptTokens += len(text)/4 + 1
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	writeJSON(w, http.StatusOK, resp)
+}
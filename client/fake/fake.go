@@ -0,0 +1,166 @@
+// package fake provides scripted http servers mimicking the provider apis, for offline testing
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Reply is one scripted response of a fake server
+type Reply struct {
+	Content       string     // assistant text
+	ToolCalls     []ToolCall // tool calls, if any
+	Transcription string     // text for transcription requests
+	Segments      []Segment  // for transcription requests asking for timestamps
+	Status        int        // if non-zero and not 200, an error with this http status
+	RetryAfter    string     // Retry-After header sent with an error status
+	Drop          bool       // drop the connection: after streaming the content, or at once if not streaming
+}
+
+// Segment is a timed stretch of a transcription
+type Segment struct {
+	Start, End float64
+	Text       string
+}
+
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // json
+}
+
+// Server replays its replies in order, one per request, recording each request body
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	replies  []Reply
+	requests []json.RawMessage
+}
+
+// BaseURL is what to configure as the provider's base url
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Requests returns the bodies of all requests received so far
+func (s *Server) Requests() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]json.RawMessage(nil), s.requests...)
+}
+
+// next pops the next reply, recording the request body
+func (s *Server) next(r *http.Request) (Reply, []byte, bool, error) {
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Reply{}, nil, false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if json.Valid(buf) {
+		s.requests = append(s.requests, buf)
+	}
+	if len(s.replies) == 0 {
+		return Reply{}, buf, false, nil
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	return reply, buf, true, nil
+}
+
+func newServer(replies []Reply, routes func(*Server, *http.ServeMux)) *Server {
+	s := &Server{replies: replies}
+	mux := http.NewServeMux()
+	routes(s, mux)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// handle wraps a handler with reply popping and error statuses
+func (s *Server) handle(f func(w http.ResponseWriter, r *http.Request, body []byte, reply Reply), writeError func(http.ResponseWriter, int, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reply, body, ok, err := s.next(r)
+		switch {
+		case err != nil:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case !ok:
+			writeError(w, http.StatusInternalServerError, "no more scripted replies")
+		case reply.Status != 0 && reply.Status != http.StatusOK:
+			if len(reply.RetryAfter) > 0 {
+				w.Header().Set("Retry-After", reply.RetryAfter)
+			}
+			writeError(w, reply.Status, http.StatusText(reply.Status))
+		case reply.Drop && !isStream(body):
+			panic(http.ErrAbortHandler)
+		default:
+			f(w, r, body, reply)
+		}
+	}
+}
+
+// chunks splits text into a few pieces, to exercise stream assembly
+func chunks(s string) []string {
+	var out []string
+	for len(s) > 0 {
+		n := min(len(s), 7)
+		out = append(out, s[:n])
+		s = s[n:]
+	}
+	return out
+}
+
+// drop cuts a stream short, as a dropped connection would, if the reply says to
+func drop(reply Reply) {
+	if reply.Drop {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// sse starts a server-sent event stream, returning a function to emit events
+func sse(w http.ResponseWriter) func(event string, data any) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	return func(event string, data any) {
+		if len(event) > 0 {
+			fmt.Fprintf(w, "event: %s\n", event)
+		}
+		switch data := data.(type) {
+		case string:
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		default:
+			buf, _ := json.Marshal(data)
+			fmt.Fprintf(w, "data: %s\n\n", buf)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func isStream(body []byte) bool {
+	var r struct {
+		Stream bool `json:"stream"`
+	}
+	json.Unmarshal(body, &r)
+	return r.Stream
+}
+
+// tokens roughly counts the tokens of a request and reply, for usage reports
+func tokens(body []byte, reply Reply) (prompt, completion int) {
+	completion = len(reply.Content)
+	for _, c := range reply.ToolCalls {
+		completion += len(c.Name) + len(c.Arguments)
+	}
+	return len(body) / 4, completion/4 + 1
+}
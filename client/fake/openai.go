@@ -0,0 +1,185 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI returns a fake of openai's chat completion, embedding and transcription apis
+func OpenAI(replies ...Reply) *Server {
+	return newServer(replies, func(s *Server, mux *http.ServeMux) {
+		mux.Handle("POST /v1/chat/completions", s.handle(openaiChat, openaiError))
+		mux.HandleFunc("POST /v1/embeddings", openaiEmbeddings)
+		mux.Handle("POST /v1/audio/transcriptions", s.handle(openaiTranscription, openaiError))
+		mux.Handle("POST /v1/audio/translations", s.handle(openaiTranscription, openaiError))
+	})
+}
+
+// Ollama returns a fake of ollama's openai-compatible api
+func Ollama(replies ...Reply) *Server {
+	return newServer(replies, func(s *Server, mux *http.ServeMux) {
+		mux.Handle("POST /v1/chat/completions", s.handle(openaiChat, openaiError))
+		mux.HandleFunc("POST /v1/embeddings", openaiEmbeddings)
+	})
+}
+
+func openaiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    "fake_error",
+		},
+	})
+}
+
+func openaiToolCalls(reply Reply) []openai.ToolCall {
+	var calls []openai.ToolCall
+	for _, c := range reply.ToolCalls {
+		calls = append(calls, openai.ToolCall{
+			ID:   c.ID,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      c.Name,
+				Arguments: c.Arguments,
+			},
+		})
+	}
+	return calls
+}
+
+func openaiFinishReason(reply Reply) openai.FinishReason {
+	if len(reply.ToolCalls) > 0 {
+		return openai.FinishReasonToolCalls
+	}
+	return openai.FinishReasonStop
+}
+
+func openaiChat(w http.ResponseWriter, r *http.Request, body []byte, reply Reply) {
+	prompt, completion := tokens(body, reply)
+	usage := openai.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+	if !isStream(body) {
+		writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+			ID:     "fake",
+			Object: "chat.completion",
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message: openai.ChatCompletionMessage{
+						Role:      openai.ChatMessageRoleAssistant,
+						Content:   reply.Content,
+						ToolCalls: openaiToolCalls(reply),
+					},
+					FinishReason: openaiFinishReason(reply),
+				},
+			},
+			Usage: usage,
+		})
+		return
+	}
+	emit := sse(w)
+	chunk := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) {
+		emit("", openai.ChatCompletionStreamResponse{
+			ID:     "fake",
+			Object: "chat.completion.chunk",
+			Choices: []openai.ChatCompletionStreamChoice{
+				{Delta: delta, FinishReason: finish},
+			},
+		})
+	}
+	chunk(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	for _, c := range chunks(reply.Content) {
+		chunk(openai.ChatCompletionStreamChoiceDelta{Content: c}, "")
+	}
+	drop(reply)
+	for i, call := range openaiToolCalls(reply) {
+		index := i
+		chunk(openai.ChatCompletionStreamChoiceDelta{
+			ToolCalls: []openai.ToolCall{
+				{
+					Index:    &index,
+					ID:       call.ID,
+					Type:     openai.ToolTypeFunction,
+					Function: openai.FunctionCall{Name: call.Function.Name},
+				},
+			},
+		}, "")
+		for _, c := range chunks(call.Function.Arguments) {
+			chunk(openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{
+					{
+						Index:    &index,
+						Function: openai.FunctionCall{Arguments: c},
+					},
+				},
+			}, "")
+		}
+	}
+	chunk(openai.ChatCompletionStreamChoiceDelta{}, openaiFinishReason(reply))
+	var options struct {
+		StreamOptions struct {
+			IncludeUsage bool `json:"include_usage"`
+		} `json:"stream_options"`
+	}
+	json.Unmarshal(body, &options)
+	if options.StreamOptions.IncludeUsage {
+		emit("", openai.ChatCompletionStreamResponse{
+			ID:      "fake",
+			Object:  "chat.completion.chunk",
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   &usage,
+		})
+	}
+	emit("", "[DONE]")
+}
+
+func openaiTranscription(w http.ResponseWriter, r *http.Request, body []byte, reply Reply) {
+	if formValue(r, body, "response_format") != string(openai.AudioResponseFormatVerboseJSON) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"text": reply.Transcription,
+		})
+		return
+	}
+	segments := []map[string]any{}
+	var duration float64
+	for i, s := range reply.Segments {
+		segments = append(segments, map[string]any{"id": i, "start": s.Start, "end": s.End, "text": s.Text})
+		duration = max(duration, s.End)
+	}
+	task := "transcribe"
+	if strings.HasSuffix(r.URL.Path, "/translations") {
+		task = "translate"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"task":     task,
+		"language": "english",
+		"duration": duration,
+		"text":     reply.Transcription,
+		"segments": segments,
+	})
+}
+
+// formValue reads a field of a multipart request body
+func formValue(r *http.Request, body []byte, field string) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		return ""
+	}
+	defer form.RemoveAll()
+	if v := form.Value[field]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,270 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Model describes a chat model and what it can do
+type Model struct {
+	Name            string // registry key, e.g. "gpt-4-turbo"
+	Provider        string // one of the *Provider names
+	WireName        string // name sent to the api, if different from Name
+	ContextWindow   int    // in tokens
+	MaxOutputTokens int
+	Tools           bool // supports tool calls
+	JSONMode        bool // supports a json response format
+	Structured      bool // supports strict json_schema response formats
+	Images          bool // supports image input
+	Audio           bool // supports audio input
+	Pricing         Pricing
+}
+
+// Pricing is in dollars per million tokens
+type Pricing struct {
+	Prompt     float64
+	Completion float64
+	Cached     float64 // for cached prompt tokens; if zero, the Prompt rate
+}
+
+// Cost estimates the dollar cost of the usage
+func (p Pricing) Cost(u Usage) float64 {
+	cached := p.Cached
+	if cached == 0 {
+		cached = p.Prompt
+	}
+	uncached := u.PromptTokens - u.CachedTokens
+	return (float64(uncached)*p.Prompt + float64(u.CachedTokens)*cached + float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// Wire is the model name to send to the api, empty for the zero Model
+func (m Model) Wire() string {
+	if len(m.WireName) > 0 {
+		return m.WireName
+	}
+	return m.Name
+}
+
+// Requirements are the capabilities a request needs from a model
+type Requirements struct {
+	Provider         string // if empty, any provider
+	Tools            bool
+	JSONMode         bool
+	Images           bool
+	Audio            bool
+	MinContextWindow int
+}
+
+func (m Model) Satisfies(r Requirements) bool {
+	switch {
+	case len(r.Provider) > 0 && r.Provider != m.Provider:
+		return false
+	case r.Tools && !m.Tools:
+		return false
+	case r.JSONMode && !m.JSONMode:
+		return false
+	case r.Images && !m.Images:
+		return false
+	case r.Audio && !m.Audio:
+		return false
+	case m.ContextWindow < r.MinContextWindow:
+		return false
+	}
+	return true
+}
+
+var registry struct {
+	sync.RWMutex
+	models   []Model           // in order of preference
+	defaults map[string]string // model name by provider
+}
+
+// Register adds a model, or replaces the one with the same name in place
+func Register(m Model) error {
+	if len(m.Name) == 0 {
+		return fmt.Errorf("model needs a name")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for i, x := range registry.models {
+		if x.Name == m.Name {
+			registry.models[i] = m
+			return nil
+		}
+	}
+	registry.models = append(registry.models, m)
+	return nil
+}
+
+// Lookup finds a registered model by name
+func Lookup(name string) (Model, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, m := range registry.models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+// Models lists the registered models, in order of preference
+func Models() []Model {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]Model(nil), registry.models...)
+}
+
+// SetDefault makes a registered model its provider's default, which Select
+// prefers and requests without a model use
+func SetDefault(name string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, m := range registry.models {
+		if m.Name == name {
+			if registry.defaults == nil {
+				registry.defaults = make(map[string]string)
+			}
+			registry.defaults[m.Provider] = name
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown model: %q", name)
+}
+
+// Default returns the provider's default model, if it has one
+func Default(provider string) (Model, bool) {
+	registry.RLock()
+	name, ok := registry.defaults[provider]
+	registry.RUnlock()
+	if !ok {
+		return Model{}, false
+	}
+	return Lookup(name)
+}
+
+// Select returns the provider's default model if it meets the requirements,
+// otherwise the most preferred registered model which does
+func Select(r Requirements) (Model, error) {
+	if m, ok := Default(r.Provider); ok && m.Satisfies(r) {
+		return m, nil
+	}
+	for _, m := range Models() {
+		if m.Satisfies(r) {
+			return m, nil
+		}
+	}
+	return Model{}, fmt.Errorf("no registered model satisfies %+v", r)
+}
+
+func init() {
+	for _, m := range []Model{
+		{
+			Name:            "gpt-4o",
+			Provider:        OpenAIProvider,
+			WireName:        "gpt-4o-2024-08-06",
+			ContextWindow:   128000,
+			MaxOutputTokens: 16384,
+			Tools:           true,
+			JSONMode:        true,
+			Structured:      true,
+			Images:          true,
+			Pricing:         Pricing{Prompt: 2.5, Completion: 10, Cached: 1.25},
+		},
+		{
+			Name:            "gpt-4o-mini",
+			Provider:        OpenAIProvider,
+			WireName:        "gpt-4o-mini-2024-07-18",
+			ContextWindow:   128000,
+			MaxOutputTokens: 16384,
+			Tools:           true,
+			JSONMode:        true,
+			Structured:      true,
+			Images:          true,
+			Pricing:         Pricing{Prompt: 0.15, Completion: 0.6, Cached: 0.075},
+		},
+		{
+			Name:            "gpt-4-turbo",
+			Provider:        OpenAIProvider,
+			WireName:        "gpt-4-turbo-2024-04-09",
+			ContextWindow:   128000,
+			MaxOutputTokens: 4096,
+			Tools:           true,
+			JSONMode:        true,
+			Images:          true,
+			Pricing:         Pricing{Prompt: 10, Completion: 30},
+		},
+		{
+			Name:            "gpt-3.5-turbo",
+			Provider:        OpenAIProvider,
+			WireName:        "gpt-3.5-turbo-0125",
+			ContextWindow:   16385,
+			MaxOutputTokens: 4096,
+			Tools:           true,
+			JSONMode:        true,
+			Pricing:         Pricing{Prompt: 0.5, Completion: 1.5},
+		},
+		{
+			Name:            "claude-3-opus",
+			Provider:        AnthropicProvider,
+			WireName:        "claude-3-opus-20240229",
+			ContextWindow:   200000,
+			MaxOutputTokens: 4096,
+			Tools:           true,
+			Images:          true,
+			Pricing:         Pricing{Prompt: 15, Completion: 75},
+		},
+		{
+			Name:            "claude-3-sonnet",
+			Provider:        AnthropicProvider,
+			WireName:        "claude-3-sonnet-20240229",
+			ContextWindow:   200000,
+			MaxOutputTokens: 4096,
+			Tools:           true,
+			Images:          true,
+			Pricing:         Pricing{Prompt: 3, Completion: 15},
+		},
+		{
+			Name:            "claude-3-haiku",
+			Provider:        AnthropicProvider,
+			WireName:        "claude-3-haiku-20240307",
+			ContextWindow:   200000,
+			MaxOutputTokens: 4096,
+			Tools:           true,
+			Images:          true,
+			Pricing:         Pricing{Prompt: 0.25, Completion: 1.25},
+		},
+		{
+			Name:            "llama3.1",
+			Provider:        OllamaProvider,
+			ContextWindow:   131072,
+			MaxOutputTokens: 4096,
+			Tools:           true,
+			JSONMode:        true,
+		},
+		{
+			Name:            "llama3",
+			Provider:        OllamaProvider,
+			ContextWindow:   8192,
+			MaxOutputTokens: 2048,
+			JSONMode:        true,
+		},
+		{
+			Name:            "llava",
+			Provider:        OllamaProvider,
+			ContextWindow:   4096,
+			MaxOutputTokens: 2048,
+			JSONMode:        true,
+			Images:          true,
+		},
+	} {
+		if err := Register(m); err != nil {
+			panic(err)
+		}
+	}
+	for _, name := range []string{"gpt-4o", "claude-3-opus", "llama3.1"} {
+		if err := SetDefault(name); err != nil {
+			panic(err)
+		}
+	}
+}
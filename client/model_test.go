@@ -0,0 +1,42 @@
+package client
+
+import "testing"
+
+func TestSelect(t *testing.T) {
+	for _, c := range []struct {
+		needs Requirements
+		want  string
+	}{
+		{Requirements{Provider: OpenAIProvider}, "gpt-4o"},
+		{Requirements{Provider: AnthropicProvider, Tools: true}, "claude-3-opus"},
+		{Requirements{Provider: OllamaProvider}, "llama3.1"},
+		{Requirements{Provider: OllamaProvider, Tools: true}, "llama3.1"},
+		{Requirements{Provider: OllamaProvider, Images: true}, "llava"},
+		{Requirements{Provider: OpenAIProvider, MinContextWindow: 100000, Images: true}, "gpt-4o"},
+	} {
+		m, err := Select(c.needs)
+		if err != nil || m.Name != c.want {
+			t.Errorf("%+v: got %q, %v; want %q", c.needs, m.Name, err, c.want)
+		}
+	}
+	if m, err := Select(Requirements{Provider: OllamaProvider, Tools: true, Images: true}); err == nil {
+		t.Errorf("got %q for tools and images on ollama", m.Name)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	defer SetDefault("gpt-4o")
+	if err := SetDefault("gpt-3.5-turbo"); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := Select(Requirements{Provider: OpenAIProvider}); m.Name != "gpt-3.5-turbo" {
+		t.Errorf("selected %q", m.Name)
+	}
+	// the default is only preferred if it's capable enough:
+	if m, _ := Select(Requirements{Provider: OpenAIProvider, Images: true}); m.Name != "gpt-4o" {
+		t.Errorf("selected %q for images", m.Name)
+	}
+	if err := SetDefault("no such model"); err == nil {
+		t.Error("no error for an unknown model")
+	}
+}
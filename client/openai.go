@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// openAI serves openai's api, as well as servers compatible with it
+type openAI struct {
+	name      string
+	c         OpenAI
+	model     string // default model, if the request has none
+	embedding string // embedding model, if any
+	// of audio too large for one upload:
+	segmentation Segmentation
+}
+
+// NewOpenAI returns a provider backed by a go-openai client
+func NewOpenAI(c OpenAI) Provider {
+	return &openAI{name: OpenAIProvider, c: c}
+}
+
+func (p *openAI) Name() string {
+	return p.name
+}
+
+func (p *openAI) DefaultModel() string {
+	if len(p.model) > 0 {
+		return p.model
+	}
+	m, _ := Default(OpenAIProvider)
+	return m.Wire()
+}
+
+func (p *openAI) Complete(ctx context.Context, r CompletionRequest) (*CompletionResponse, error) {
+	if len(r.Model.Wire()) == 0 && len(p.model) > 0 {
+		r.Model = Model{Name: p.model}
+	}
+	return CompleteContext(ctx, p.c, r)
+}
+
+func (p *openAI) TranscribeAV(ctx context.Context, r TranscriptionRequest) (string, error) {
+	if p.name == OllamaProvider {
+		return "", fmt.Errorf("%s transcription: %w", p.name, ErrUnsupported)
+	}
+	t, err := transcribe(ctx, p.c, r, p.segmentation, false)
+	if err != nil {
+		return "", err
+	}
+	return render(t, r.Options.Format)
+}
+
+func (p *openAI) Transcribe(ctx context.Context, r TranscriptionRequest) (*Transcription, error) {
+	if p.name == OllamaProvider {
+		return nil, fmt.Errorf("%s transcription: %w", p.name, ErrUnsupported)
+	}
+	return transcribe(ctx, p.c, r, p.segmentation, true)
+}
+
+func (p *openAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	model := p.embedding
+	if len(model) == 0 {
+		if p.name != OpenAIProvider {
+			return nil, fmt.Errorf("%s embeddings need a model: %w", p.name, ErrUnsupported)
+		}
+		model = string(openai.SmallEmbedding3)
+	}
+	resp, err := p.c.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(out) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	for i, v := range out {
+		if v == nil {
+			return nil, fmt.Errorf("no embedding for text %d", i)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,280 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/client"
+	"xoba.com/llm/client/fake"
+)
+
+// providers are the built-in providers, with their fakes
+var providers = []struct {
+	name string
+	fake func(...fake.Reply) *fake.Server
+}{
+	{client.OpenAIProvider, fake.OpenAI},
+	{client.OllamaProvider, fake.Ollama},
+	{client.AnthropicProvider, fake.Anthropic},
+}
+
+// start runs a fake provider, returning a client for it without retries
+func start(t *testing.T, provider string, server func(...fake.Reply) *fake.Server, replies ...fake.Reply) (client.Interface, *fake.Server) {
+	t.Helper()
+	s := server(replies...)
+	t.Cleanup(s.Close)
+	c, err := client.NewFromConfig(client.Config{
+		Provider: provider,
+		Key:      "test",
+		BaseURL:  s.BaseURL(),
+		Retry:    client.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+// text asks for text, the zero format being invalid
+func text(messages []openai.ChatCompletionMessage) client.CompletionRequest {
+	return client.CompletionRequest{Format: client.NoneSpecified, Messages: messages}
+}
+
+func user(text string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: text}}
+}
+
+// completion runs a request both whole and streamed, checking they agree
+func completion(t *testing.T, provider string, server func(...fake.Reply) *fake.Server, r client.CompletionRequest, reply fake.Reply) (*client.CompletionResponse, []json.RawMessage) {
+	t.Helper()
+	c, s := start(t, provider, server, reply, reply)
+	whole, err := c.Complete(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed strings.Builder
+	var deltas []client.ToolDelta
+	r.Stream = &streamed
+	r.ToolDeltas = func(d client.ToolDelta) { deltas = append(deltas, d) }
+	resp, err := c.Complete(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != whole.Content || resp.FinishReason != whole.FinishReason || len(resp.FunctionCalls) != len(whole.FunctionCalls) {
+		t.Errorf("streamed %+v, whole %+v", resp, whole)
+	}
+	for i, f := range whole.FunctionCalls {
+		if *resp.FunctionCalls[i] != *f {
+			t.Errorf("streamed call %+v, whole %+v", resp.FunctionCalls[i], f)
+		}
+	}
+	if streamed.String() != resp.Content {
+		t.Errorf("streamed %q, content %q", streamed.String(), resp.Content)
+	}
+	arguments := make(map[int]string)
+	for _, d := range deltas {
+		arguments[d.Index] += d.Arguments
+	}
+	for i, f := range resp.FunctionCalls {
+		if arguments[i] != f.Arguments {
+			t.Errorf("deltas of call %d: %q, want %q", i, arguments[i], f.Arguments)
+		}
+	}
+	requests := s.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(requests))
+	}
+	return whole, requests
+}
+
+func TestText(t *testing.T) {
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			resp, requests := completion(t, p.name, p.fake, text(user("hi")), fake.Reply{Content: "hello there, how are you?"})
+			if resp.Content != "hello there, how are you?" || resp.FinishReason != "stop" {
+				t.Errorf("got %+v", resp)
+			}
+			if resp.Usage.TotalTokens == 0 {
+				t.Errorf("no usage in %+v", resp)
+			}
+			if !strings.Contains(string(requests[0]), `"hi"`) {
+				t.Errorf("prompt missing from %s", requests[0])
+			}
+		})
+	}
+}
+
+func TestTools(t *testing.T) {
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+		Name:       "add",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"x":{"type":"number"}}}`),
+	}}}
+	reply := fake.Reply{ToolCalls: []fake.ToolCall{
+		{ID: "call1", Name: "add", Arguments: `{"x":1,"y":2}`},
+		{ID: "call2", Name: "add", Arguments: `{"x":3}`},
+	}}
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			resp, requests := completion(t, p.name, p.fake, client.CompletionRequest{Format: client.NoneSpecified, Messages: user("add"), Tools: tools}, reply)
+			if len(resp.FunctionCalls) != 2 || resp.FinishReason != "tool_calls" {
+				t.Fatalf("got %+v", resp)
+			}
+			for i, want := range reply.ToolCalls {
+				got := resp.FunctionCalls[i]
+				if got.ID != want.ID || got.Name != want.Name || got.Arguments != want.Arguments {
+					t.Errorf("call %d: got %+v, want %+v", i, got, want)
+				}
+			}
+			if !strings.Contains(string(requests[0]), `"add"`) {
+				t.Errorf("tool missing from %s", requests[0])
+			}
+		})
+	}
+}
+
+// calls are indexed among calls, not after any text before them
+func TestTextThenTools(t *testing.T) {
+	reply := fake.Reply{Content: "let me add those", ToolCalls: []fake.ToolCall{
+		{ID: "call1", Name: "add", Arguments: `{"x":1,"y":2}`},
+		{ID: "call2", Name: "add", Arguments: `{"x":3}`},
+	}}
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			c, _ := start(t, p.name, p.fake, reply)
+			r := client.CompletionRequest{Format: client.NoneSpecified, Messages: user("add")}
+			var streamed strings.Builder
+			var deltas []client.ToolDelta
+			r.Stream = &streamed
+			r.ToolDeltas = func(d client.ToolDelta) { deltas = append(deltas, d) }
+			resp, err := c.Complete(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if streamed.String() != reply.Content || len(resp.FunctionCalls) != 2 {
+				t.Fatalf("streamed %q, got %+v", streamed.String(), resp)
+			}
+			arguments := make(map[int]string)
+			for _, d := range deltas {
+				if d.Index < 0 || d.Index >= len(reply.ToolCalls) {
+					t.Fatalf("delta %+v of no call", d)
+				}
+				if len(d.ID) > 0 && d.ID != reply.ToolCalls[d.Index].ID {
+					t.Errorf("delta %+v of call %q", d, reply.ToolCalls[d.Index].ID)
+				}
+				arguments[d.Index] += d.Arguments
+			}
+			if len(arguments) != 2 || arguments[0] != reply.ToolCalls[0].Arguments || arguments[1] != reply.ToolCalls[1].Arguments {
+				t.Errorf("arguments by index %q", arguments)
+			}
+			// and whole responses agree:
+			completion(t, p.name, p.fake, client.CompletionRequest{Format: client.NoneSpecified, Messages: user("add")}, reply)
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			resp, requests := completion(t, p.name, p.fake, client.CompletionRequest{Messages: user("json please"), Format: client.JSONResponse}, fake.Reply{Content: `{"answer": 42}`})
+			if resp.Content != `{"answer": 42}` {
+				t.Errorf("got %q", resp.Content)
+			}
+			var body struct {
+				ResponseFormat *struct {
+					Type string `json:"type"`
+				} `json:"response_format"`
+				Messages []struct {
+					Role    string          `json:"role"`
+					Content json.RawMessage `json:"content"`
+				} `json:"messages"`
+			}
+			if err := json.Unmarshal(requests[0], &body); err != nil {
+				t.Fatal(err)
+			}
+			switch p.name {
+			case client.AnthropicProvider:
+				// no json mode, so the answer is prefilled:
+				last := body.Messages[len(body.Messages)-1]
+				if last.Role != "assistant" || !strings.Contains(string(last.Content), `"{"`) {
+					t.Errorf("no prefill in %s", requests[0])
+				}
+			default:
+				if body.ResponseFormat == nil || body.ResponseFormat.Type != "json_object" {
+					t.Errorf("no json mode in %s", requests[0])
+				}
+			}
+		})
+	}
+}
+
+func TestImages(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{{
+		Role: openai.ChatMessageRoleUser,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "what's this?"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,iVBORw0KGgo="}},
+		},
+	}}
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			_, requests := completion(t, p.name, p.fake, text(messages), fake.Reply{Content: "a picture"})
+			body := string(requests[0])
+			want := `"image_url"`
+			if p.name == client.AnthropicProvider {
+				want = `"media_type":"image/png"`
+			}
+			if !strings.Contains(body, want) || !strings.Contains(body, "iVBORw0KGgo=") {
+				t.Errorf("no image in %s", body)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			for _, stream := range []bool{false, true} {
+				c, _ := start(t, p.name, p.fake, fake.Reply{Status: http.StatusBadRequest})
+				r := text(user("hi"))
+				var streamed strings.Builder
+				if stream {
+					r.Stream = &streamed
+				}
+				_, err := c.CompleteContext(context.Background(), r)
+				if err == nil {
+					t.Fatal("no error")
+				}
+				var status int
+				var oa *openai.APIError
+				var ae *client.APIError
+				switch {
+				case errors.As(err, &oa):
+					status = oa.HTTPStatusCode
+				case errors.As(err, &ae):
+					status = ae.StatusCode
+				}
+				if status != http.StatusBadRequest {
+					t.Errorf("stream %v: got status %d from %v", stream, status, err)
+				}
+				if client.IsRetryable(err) {
+					t.Errorf("stream %v: %v is retryable", stream, err)
+				}
+				if streamed.Len() > 0 {
+					t.Errorf("streamed %q", streamed.String())
+				}
+			}
+		})
+	}
+}
+
+func TestAnthropicUnsupported(t *testing.T) {
+	c, _ := start(t, client.AnthropicProvider, fake.Anthropic)
+	if _, err := c.TranscribeAV(client.TranscriptionRequest{}); !errors.Is(err, client.ErrUnsupported) {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+}
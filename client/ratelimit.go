@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces requests and tokens per minute with token buckets. it's
+// safe for concurrent use, and may be shared by clients using the same account.
+type RateLimiter struct {
+	mu       sync.Mutex
+	requests bucket
+	tokens   bucket
+}
+
+// NewRateLimiter allows bursts up to the per-minute limits, refilling evenly;
+// a zero limit means none
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	t := now()
+	return &RateLimiter{
+		requests: newBucket(requestsPerMinute, t),
+		tokens:   newBucket(tokensPerMinute, t),
+	}
+}
+
+type bucket struct {
+	capacity float64 // zero for unlimited
+	level    float64 // may go negative, as reservations are made ahead
+	last     time.Time
+}
+
+func newBucket(perMinute int, now time.Time) bucket {
+	return bucket{capacity: float64(perMinute), level: float64(perMinute), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.capacity == 0 {
+		return
+	}
+	b.level = min(b.capacity, b.level+now.Sub(b.last).Minutes()*b.capacity)
+	b.last = now
+}
+
+// take reserves n, returning how long until the reservation is covered
+func (b *bucket) take(n float64) time.Duration {
+	if b.capacity == 0 {
+		return 0
+	}
+	b.level -= min(n, b.capacity)
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.capacity * float64(time.Minute))
+}
+
+// Wait blocks until one request of about the given number of tokens is
+// allowed, or ctx is done. a nil limiter never waits.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	t := now()
+	l.requests.refill(t)
+	l.tokens.refill(t)
+	d := max(l.requests.take(1), l.tokens.take(float64(tokens)))
+	l.mu.Unlock()
+	if d == 0 {
+		return nil
+	}
+	if err := sleep(ctx, d); err != nil {
+		l.mu.Lock()
+		l.requests.level++
+		l.tokens.level += min(float64(tokens), l.tokens.capacity)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Adjust corrects the token count of a past Wait, once actual usage is known
+func (l *RateLimiter) Adjust(tokens int) {
+	if l == nil || l.tokens.capacity == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.level = min(l.tokens.capacity, l.tokens.level-float64(tokens))
+}
+
+// estimateTokens sizes a request for rate limiting, including its output allowance
+func estimateTokens(r CompletionRequest) int {
+	return r.Model.CountRequest(r) + max(r.MaxTokens, 0)
+}
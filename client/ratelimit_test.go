@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	c := useFakeClock(t)
+	ctx := context.Background()
+	l := NewRateLimiter(60, 6000)
+	wait := func(tokens int, want ...time.Duration) {
+		t.Helper()
+		c.slept = nil
+		if err := l.Wait(ctx, tokens); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.slept, want) {
+			t.Errorf("%d tokens: slept %v, want %v", tokens, c.slept, want)
+		}
+	}
+	// a full bucket allows a burst:
+	for range 6 {
+		wait(1000)
+	}
+	// then 6000 tokens a minute is 100 a second:
+	wait(1000, 10*time.Second)
+	c.t = c.t.Add(5 * time.Second)
+	wait(1000, 5*time.Second)
+	// idling refills the bucket, but only up to its capacity:
+	c.t = c.t.Add(time.Hour)
+	wait(6000)
+	wait(100, time.Second)
+	// a request larger than the bucket waits for a full one, not forever:
+	c.t = c.t.Add(time.Hour)
+	wait(60000)
+	wait(60000, time.Minute)
+}
+
+func TestRateLimiterRequests(t *testing.T) {
+	c := useFakeClock(t)
+	l := NewRateLimiter(2, 0)
+	for range 2 {
+		if err := l.Wait(context.Background(), 1e9); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.slept) > 0 {
+		t.Fatalf("slept %v within the burst", c.slept)
+	}
+	l.Wait(context.Background(), 1e9)
+	if len(c.slept) != 1 || c.slept[0] != 30*time.Second {
+		t.Errorf("slept %v, want 30s", c.slept)
+	}
+}
+
+func TestRateLimiterAdjust(t *testing.T) {
+	c := useFakeClock(t)
+	l := NewRateLimiter(0, 600)
+	l.Wait(context.Background(), 600)
+	// the request used less than estimated, which is returned:
+	l.Adjust(-300)
+	l.Wait(context.Background(), 300)
+	if len(c.slept) > 0 {
+		t.Errorf("slept %v after a refund", c.slept)
+	}
+	// or more, which is owed:
+	l.Adjust(600)
+	l.Wait(context.Background(), 60)
+	if len(c.slept) != 1 || c.slept[0] != 66*time.Second {
+		t.Errorf("slept %v, want 66s", c.slept)
+	}
+	// refunds don't overfill it:
+	c.t = c.t.Add(time.Hour)
+	l.Adjust(-10000)
+	if l.tokens.level != 600 {
+		t.Errorf("level %v after a refund", l.tokens.level)
+	}
+}
+
+func TestRateLimiterCanceled(t *testing.T) {
+	c := useFakeClock(t)
+	l := NewRateLimiter(1, 100)
+	l.Wait(context.Background(), 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, 100); err != context.Canceled {
+		t.Fatalf("got %v", err)
+	}
+	// a canceled wait gives back its reservation:
+	if l.requests.level != 0 || l.tokens.level != 0 {
+		t.Errorf("levels %v and %v after canceling", l.requests.level, l.tokens.level)
+	}
+	c.t = c.t.Add(time.Minute)
+	l.Wait(context.Background(), 100)
+	if len(c.slept) > 0 {
+		t.Errorf("slept %v", c.slept)
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var l *RateLimiter
+	if err := l.Wait(context.Background(), 1000); err != nil {
+		t.Error(err)
+	}
+	l.Adjust(10)
+}
@@ -0,0 +1,250 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"xoba.com/llm/cache"
+)
+
+//go:generate stringer -type=CacheMode
+type CacheMode int
+
+const (
+	CacheReadWrite CacheMode = iota // replay cached responses, completing and caching the rest
+	CacheReplay                     // replay cached responses, failing the rest with ErrNotCached, for deterministic tests
+	CacheRecord                     // complete every request, caching its response over any cached one
+)
+
+// ErrNotCached is returned under CacheReplay for requests never cached
+var ErrNotCached = errors.New("response not cached")
+
+// ResponseCache configures the caching of completions by NewCached. the zero
+// value caches in memory, forever.
+type ResponseCache struct {
+	Store cache.Cache   // if nil, cache.NewMemory(0); cache.NewDir keeps responses across runs
+	TTL   time.Duration // how long responses are replayed; if zero, forever
+	Mode  CacheMode
+}
+
+// Cached is a client replaying the responses to requests it has seen, keyed
+// by a hash of the model, messages, tools, format and parameters. replayed
+// responses are streamed, content and tool deltas alike, as they were first,
+// and marked Replayed, with zero usage. it's safe for concurrent use.
+type Cached struct {
+	c      Interface
+	config ResponseCache
+	mu     sync.Mutex
+	stats  cache.Stats
+}
+
+// NewCached wraps a client with a response cache
+func NewCached(c Interface, config ResponseCache) *Cached {
+	if config.Store == nil {
+		config.Store = cache.NewMemory(0)
+	}
+	return &Cached{c: c, config: config}
+}
+
+func (c *Cached) Provider() string {
+	return c.c.Provider()
+}
+
+func (c *Cached) TranscribeAV(r TranscriptionRequest) (string, error) {
+	return c.c.TranscribeAV(r)
+}
+
+func (c *Cached) TranscribeAVContext(ctx context.Context, r TranscriptionRequest) (string, error) {
+	return c.c.TranscribeAVContext(ctx, r)
+}
+
+// Transcribe transcribes with segment timestamps, if the wrapped client can
+func (c *Cached) Transcribe(ctx context.Context, r TranscriptionRequest) (*Transcription, error) {
+	t, ok := c.c.(Transcriber)
+	if !ok {
+		return nil, fmt.Errorf("%s timestamped transcription: %w", c.c.Provider(), ErrUnsupported)
+	}
+	return t.Transcribe(ctx, r)
+}
+
+func (c *Cached) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e, ok := c.c.(Embedder)
+	if !ok {
+		return nil, fmt.Errorf("%s embeddings: %w", c.c.Provider(), ErrUnsupported)
+	}
+	return e.Embed(ctx, texts)
+}
+
+// DefaultModel is the wrapped client's, if known
+func (c *Cached) DefaultModel() string {
+	if d, ok := c.c.(DefaultModeler); ok {
+		return d.DefaultModel()
+	}
+	return ""
+}
+
+func (c *Cached) Complete(r CompletionRequest) (*CompletionResponse, error) {
+	return c.CompleteContext(context.Background(), r)
+}
+
+func (c *Cached) CompleteContext(ctx context.Context, r CompletionRequest) (*CompletionResponse, error) {
+	key, err := c.key(r)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.Mode != CacheRecord {
+		if x, ok := c.lookup(key); ok {
+			return x.replay(ctx, r)
+		}
+		if c.config.Mode == CacheReplay {
+			return nil, fmt.Errorf("%s completion: %w", c.c.Provider(), ErrNotCached)
+		}
+	}
+	rec := new(recording)
+	resp, err := c.c.CompleteContext(ctx, rec.record(r))
+	if err != nil {
+		return nil, err
+	}
+	rec.Time = time.Now()
+	rec.Response = resp
+	if b, err := json.Marshal(rec); err == nil {
+		c.config.Store.Put(key, b) // failing to cache is no failure
+	}
+	return resp, nil
+}
+
+// Stats counts the requests replayed, or completed for want of a cached response
+func (c *Cached) Stats() cache.Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// key hashes all of a request that shapes its response, including the
+// default model of requests naming none
+func (c *Cached) key(r CompletionRequest) (string, error) {
+	model := r.Model.Wire()
+	if len(model) == 0 {
+		model = c.DefaultModel()
+	}
+	var schema json.RawMessage
+	if r.Schema != nil {
+		b, err := r.Schema.MarshalJSON()
+		if err != nil {
+			return "", fmt.Errorf("can't encode schema: %w", err)
+		}
+		schema = b
+	}
+	return cache.Key("completion", nil, struct {
+		Provider  string
+		Model     string
+		Format    ResponseFormat
+		MaxTokens int
+		Tools     any
+		Messages  any
+		Schema    json.RawMessage
+		Logprobs  int
+	}{c.c.Provider(), model, r.Format, r.MaxTokens, r.Tools, r.Messages, schema, r.Logprobs}), nil
+}
+
+// lookup returns an unexpired recording
+func (c *Cached) lookup(key string) (*recording, bool) {
+	var x recording
+	b, ok := c.config.Store.Get(key)
+	ok = ok && json.Unmarshal(b, &x) == nil && x.Response != nil
+	ok = ok && (c.config.TTL <= 0 || time.Since(x.Time) < c.config.TTL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	return &x, true
+}
+
+// recording is a response, with its output as it was streamed
+type recording struct {
+	sync.Mutex `json:"-"`
+	Time       time.Time
+	Response   *CompletionResponse
+	Stream     []streamed // empty if the request wasn't streamed
+	w          io.Writer
+}
+
+// streamed is a fragment of streamed output: content, or a tool delta
+type streamed struct {
+	Text string     `json:",omitempty"`
+	Tool *ToolDelta `json:",omitempty"`
+}
+
+func (x *recording) Write(p []byte) (int, error) {
+	x.Lock()
+	x.Stream = append(x.Stream, streamed{Text: string(p)})
+	x.Unlock()
+	if x.w == nil {
+		return len(p), nil
+	}
+	return x.w.Write(p)
+}
+
+// record redirects a streamed request's output through x, tool deltas
+// included, so that replays to any caller are complete
+func (x *recording) record(r CompletionRequest) CompletionRequest {
+	if r.Stream == nil {
+		return r
+	}
+	x.w = r.Stream
+	r.Stream = x
+	f := r.ToolDeltas
+	r.ToolDeltas = func(d ToolDelta) {
+		x.Lock()
+		x.Stream = append(x.Stream, streamed{Tool: &d})
+		x.Unlock()
+		if f != nil {
+			f(d)
+		}
+	}
+	return r
+}
+
+// replay streams a recording's output as the request asks, and returns its
+// response. a response recorded without streaming is streamed whole.
+func (x *recording) replay(ctx context.Context, r CompletionRequest) (*CompletionResponse, error) {
+	// reporting the original usage would count it twice:
+	resp := *x.Response
+	resp.Usage, resp.Replayed = Usage{}, true
+	if r.Stream == nil {
+		return &resp, nil
+	}
+	fragments := x.Stream
+	if len(fragments) == 0 {
+		if len(x.Response.Content) > 0 {
+			fragments = append(fragments, streamed{Text: x.Response.Content})
+		}
+		for i, f := range x.Response.FunctionCalls {
+			fragments = append(fragments, streamed{Tool: &ToolDelta{Index: i, ID: f.ID, Name: f.Name, Arguments: f.Arguments}})
+		}
+	}
+	for _, s := range fragments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch {
+		case s.Tool != nil:
+			if r.ToolDeltas != nil {
+				r.ToolDeltas(*s.Tool)
+			}
+		default:
+			if _, err := io.WriteString(r.Stream, s.Text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &resp, nil
+}
@@ -0,0 +1,105 @@
+package client_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xoba.com/llm/cache"
+	"xoba.com/llm/client"
+	"xoba.com/llm/client/fake"
+)
+
+func TestCached(t *testing.T) {
+	c, s := start(t, client.OpenAIProvider, fake.OpenAI, fake.Reply{Content: "hello there"}, fake.Reply{Content: "unused"})
+	cached := client.NewCached(c, client.ResponseCache{})
+	first, err := cached.Complete(text(user("hi")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Replayed || first.Usage.TotalTokens == 0 {
+		t.Errorf("first %+v", first)
+	}
+	r := text(user("hi"))
+	var streamed strings.Builder
+	r.Stream = &streamed
+	again, err := cached.Complete(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing was spent on the replay, so it reports no usage:
+	if !again.Replayed || again.Usage != (client.Usage{}) || again.Content != first.Content {
+		t.Errorf("replayed %+v", again)
+	}
+	if streamed.String() != "hello there" {
+		t.Errorf("streamed %q", streamed.String())
+	}
+	if n := len(s.Requests()); n != 1 {
+		t.Errorf("%d requests", n)
+	}
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestCacheReplay(t *testing.T) {
+	c, s := start(t, client.OpenAIProvider, fake.OpenAI, fake.Reply{Content: "unused"})
+	cached := client.NewCached(c, client.ResponseCache{Mode: client.CacheReplay})
+	if _, err := cached.Complete(text(user("hi"))); !errors.Is(err, client.ErrNotCached) {
+		t.Errorf("got %v", err)
+	}
+	if n := len(s.Requests()); n != 0 {
+		t.Errorf("%d requests", n)
+	}
+}
+
+// requests naming no model are keyed by the model they'd be completed with
+func TestCachedDefaultModels(t *testing.T) {
+	store := cache.NewMemory(0)
+	s := fake.OpenAI(fake.Reply{Content: "from gpt-4o"}, fake.Reply{Content: "from gpt-4o-mini"}, fake.Reply{Content: "from gpt-3.5-turbo"})
+	t.Cleanup(s.Close)
+	cached := func(model string) *client.Cached {
+		c, err := client.NewFromConfig(client.Config{Key: "test", BaseURL: s.BaseURL(), Model: model})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.NewCached(c, client.ResponseCache{Store: store})
+	}
+	ask := func(c *client.Cached, want string) {
+		t.Helper()
+		resp, err := c.Complete(text(user("hi")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Content != want {
+			t.Errorf("got %q, want %q", resp.Content, want)
+		}
+	}
+	byDefault, mini := cached(""), cached("gpt-4o-mini")
+	ask(byDefault, "from gpt-4o")
+	ask(mini, "from gpt-4o-mini")
+	ask(byDefault, "from gpt-4o")
+	ask(mini, "from gpt-4o-mini")
+	// as is the process's default, when changed:
+	defer client.SetDefault("gpt-4o")
+	if err := client.SetDefault("gpt-3.5-turbo"); err != nil {
+		t.Fatal(err)
+	}
+	ask(byDefault, "from gpt-3.5-turbo")
+	var models []string
+	for _, r := range s.Requests() {
+		var req struct{ Model string }
+		json.Unmarshal(r, &req)
+		models = append(models, req.Model)
+	}
+	// the registry's defaults are sent by their snapshot names, a configured model as is:
+	wire := func(name string) string {
+		m, _ := client.Lookup(name)
+		return m.Wire()
+	}
+	if want := []string{wire("gpt-4o"), "gpt-4o-mini", wire("gpt-3.5-turbo")}; !reflect.DeepEqual(models, want) {
+		t.Errorf("requested %v, want %v", models, want)
+	}
+}
@@ -11,11 +11,12 @@ func _() {
 	_ = x[NoneSpecified-1]
 	_ = x[JSONResponse-2]
 	_ = x[TextResponse-3]
+	_ = x[JSONSchemaResponse-4]
 }
 
-const _ResponseFormat_name = "NoneSpecifiedJSONResponseTextResponse"
+const _ResponseFormat_name = "NoneSpecifiedJSONResponseTextResponseJSONSchemaResponse"
 
-var _ResponseFormat_index = [...]uint8{0, 13, 25, 37}
+var _ResponseFormat_index = [...]uint8{0, 13, 25, 37, 55}
 
 func (i ResponseFormat) String() string {
 	i -= 1
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// RetryPolicy governs retrying failed completions. the zero value retries
+// retryable errors with the defaults below.
+type RetryPolicy struct {
+	MaxAttempts int              // including the first; if zero, 4. use 1 for no retries
+	BaseDelay   time.Duration    // before the first retry, doubling with each one after; if zero, 1s
+	MaxDelay    time.Duration    // cap on any one delay, including a server's Retry-After; if zero, 1m
+	Retryable   func(error) bool // if nil, IsRetryable
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 4
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = time.Second
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = time.Minute
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	return p
+}
+
+// delay before retrying after the given attempt: exponential backoff with
+// jitter, unless the server said how long to wait
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, p.MaxDelay)
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// between half and all of d, so concurrent callers spread out:
+	return d/2 + rand.N(d/2+1)
+}
+
+// IsRetryable reports whether err is likely transient: rate limits, timeouts,
+// server errors and dropped connections, but not cancellations or exhausted quotas
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var oa *openai.APIError
+	if errors.As(err, &oa) {
+		if oa.Code == "insufficient_quota" {
+			return false
+		}
+		return retryableStatus(oa.HTTPStatusCode)
+	}
+	var re *openai.RequestError
+	if errors.As(err, &re) {
+		return retryableStatus(re.HTTPStatusCode)
+	}
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return retryableStatus(ae.StatusCode)
+	}
+	var ne net.Error
+	switch {
+	case errors.As(err, &ne):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	switch {
+	case code == http.StatusRequestTimeout, code == http.StatusConflict, code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	}
+	return false
+}
+
+// retryAfter holds the wait a server asked for, carried to the transport by context
+type retryAfter struct {
+	sync.Mutex
+	d time.Duration
+}
+
+type retryAfterKey struct{}
+
+func (r *retryAfter) get() time.Duration {
+	r.Lock()
+	defer r.Unlock()
+	return r.d
+}
+
+// retryAfterTransport records Retry-After headers into the request context's holder
+type retryAfterTransport struct {
+	next http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if r, ok := req.Context().Value(retryAfterKey{}).(*retryAfter); ok {
+		if d := parseRetryAfter(resp.Header); d > 0 {
+			r.Lock()
+			r.d = d
+			r.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// withRetryAfter returns a copy of c whose transport records Retry-After headers
+func withRetryAfter(c *http.Client) *http.Client {
+	x := *c
+	next := x.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	x.Transport = retryAfterTransport{next: next}
+	return &x
+}
+
+// parseRetryAfter reads openai's retry-after-ms, or the standard header in seconds or as a date
+func parseRetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	v := h.Get("Retry-After")
+	if len(v) == 0 {
+		return 0
+	}
+	if s, err := strconv.ParseFloat(v, 64); err == nil && s > 0 {
+		return time.Duration(s * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now())
+	}
+	return 0
+}
+
+// streamWatch notes whether any output reached the caller, after which a retry would duplicate it
+type streamWatch struct {
+	sync.Mutex
+	w        io.Writer
+	streamed bool
+}
+
+func (s *streamWatch) Write(p []byte) (int, error) {
+	s.mark()
+	return s.w.Write(p)
+}
+
+func (s *streamWatch) mark() {
+	s.Lock()
+	defer s.Unlock()
+	s.streamed = true
+}
+
+func (s *streamWatch) done() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.streamed
+}
+
+// watch redirects the request's stream and tool deltas through s
+func (s *streamWatch) watch(r CompletionRequest) CompletionRequest {
+	if r.Stream != nil {
+		s.w = r.Stream
+		r.Stream = s
+	}
+	if f := r.ToolDeltas; f != nil {
+		r.ToolDeltas = func(d ToolDelta) {
+			s.mark()
+			f(d)
+		}
+	}
+	return r
+}
+
+// the clock of retries and rate limits, replaced in tests
+var (
+	now   = time.Now
+	sleep = wait
+)
+
+// wait waits for d, or until ctx is done
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
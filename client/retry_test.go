@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/client/fake"
+)
+
+// fakeClock replaces the package's clock until the test ends, recording
+// sleeps and advancing by them
+type fakeClock struct {
+	t     time.Time
+	slept []time.Duration
+}
+
+func useFakeClock(t *testing.T) *fakeClock {
+	c := &fakeClock{t: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	saved, savedSleep := now, sleep
+	t.Cleanup(func() { now, sleep = saved, savedSleep })
+	now = func() time.Time { return c.t }
+	sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.slept = append(c.slept, d)
+		c.t = c.t.Add(d)
+		return nil
+	}
+	return c
+}
+
+func TestDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}.withDefaults()
+	for attempt := 1; attempt <= 70; attempt++ {
+		// 1s, 2s, 4s, 8s, then capped, even once doubling overflows:
+		d := p.MaxDelay
+		if attempt <= 4 {
+			d = time.Second << (attempt - 1)
+		}
+		for range 100 {
+			if got := p.delay(attempt, 0); got < d/2 || got > d {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", attempt, got, d/2, d)
+			}
+		}
+	}
+	// the server's wait wins, but is capped too:
+	if got := p.delay(1, 7*time.Second); got != 7*time.Second {
+		t.Errorf("retry after 7s: delay %v", got)
+	}
+	if got := p.delay(1, time.Hour); got != p.MaxDelay {
+		t.Errorf("retry after an hour: delay %v", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	c := useFakeClock(t)
+	for _, test := range []struct {
+		header, value string
+		want          time.Duration
+	}{
+		{"Retry-After", "", 0},
+		{"Retry-After", "120", 2 * time.Minute},
+		{"Retry-After", "1.5", 1500 * time.Millisecond},
+		{"Retry-After", "0", 0},
+		{"Retry-After", "-3", 0},
+		{"Retry-After", c.t.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{"Retry-After", c.t.Add(-time.Minute).Format(http.TimeFormat), -time.Minute},
+		{"Retry-After", c.t.Add(time.Hour).Format(time.RFC850), time.Hour},
+		{"Retry-After", "soon", 0},
+		{"Retry-After-Ms", "250", 250 * time.Millisecond},
+	} {
+		h := make(http.Header)
+		h.Set(test.header, test.value)
+		if got := parseRetryAfter(h); got != test.want {
+			t.Errorf("%s: %q = %v, want %v", test.header, test.value, got, test.want)
+		}
+	}
+	h := make(http.Header)
+	h.Set("Retry-After", "60")
+	h.Set("Retry-After-Ms", "20")
+	if got := parseRetryAfter(h); got != 20*time.Millisecond {
+		t.Errorf("retry-after-ms not preferred: %v", got)
+	}
+}
+
+// retrying starts a fake provider, returning a client for it with the policy
+func retrying(t *testing.T, provider string, policy RetryPolicy, replies ...fake.Reply) (Interface, *fake.Server) {
+	t.Helper()
+	server := fake.OpenAI
+	if provider == AnthropicProvider {
+		server = fake.Anthropic
+	}
+	s := server(replies...)
+	t.Cleanup(s.Close)
+	c, err := NewFromConfig(Config{Provider: provider, Key: "test", BaseURL: s.BaseURL(), Retry: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func hi() CompletionRequest {
+	return CompletionRequest{Format: NoneSpecified, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}}
+}
+
+func TestRetry(t *testing.T) {
+	for _, provider := range []string{OpenAIProvider, AnthropicProvider} {
+		t.Run(provider, func(t *testing.T) {
+			c := useFakeClock(t)
+			client, s := retrying(t, provider, RetryPolicy{},
+				fake.Reply{Status: http.StatusTooManyRequests, RetryAfter: "7"},
+				fake.Reply{Status: http.StatusServiceUnavailable},
+				fake.Reply{Status: http.StatusTooManyRequests, RetryAfter: c.t.Add(20 * time.Second).Format(http.TimeFormat)},
+				fake.Reply{Content: "ok"})
+			resp, err := client.Complete(hi())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Content != "ok" || len(s.Requests()) != 4 {
+				t.Errorf("got %q after %d requests", resp.Content, len(s.Requests()))
+			}
+			if len(c.slept) != 3 || c.slept[0] != 7*time.Second || c.slept[1] < time.Second || c.slept[1] > 2*time.Second {
+				t.Fatalf("slept %v", c.slept)
+			}
+			// the date is relative to the clock, which the sleeps advanced:
+			if want := 20*time.Second - c.slept[0] - c.slept[1]; c.slept[2] != want {
+				t.Errorf("slept %v for a date, want %v", c.slept[2], want)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	c := useFakeClock(t)
+	client, s := retrying(t, OpenAIProvider, RetryPolicy{MaxAttempts: 3},
+		fake.Reply{Status: http.StatusInternalServerError},
+		fake.Reply{Status: http.StatusBadGateway},
+		fake.Reply{Status: http.StatusServiceUnavailable},
+		fake.Reply{Content: "too late"})
+	_, err := client.Complete(hi())
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("got %v", err)
+	}
+	if len(s.Requests()) != 3 || len(c.slept) != 2 {
+		t.Errorf("%d requests, slept %v", len(s.Requests()), c.slept)
+	}
+
+	client, s = retrying(t, OpenAIProvider, RetryPolicy{}, fake.Reply{Status: http.StatusBadRequest}, fake.Reply{Content: "unused"})
+	if _, err := client.Complete(hi()); err == nil || strings.Contains(err.Error(), "attempts") {
+		t.Errorf("got %v for a bad request", err)
+	}
+	if len(s.Requests()) != 1 {
+		t.Errorf("bad request sent %d times", len(s.Requests()))
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	useFakeClock(t)
+	client, s := retrying(t, OpenAIProvider, RetryPolicy{}, fake.Reply{Status: http.StatusTooManyRequests}, fake.Reply{Content: "unused"})
+	ctx, cancel := context.WithCancel(context.Background())
+	sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+	if _, err := client.CompleteContext(ctx, hi()); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v", err)
+	}
+	if len(s.Requests()) != 1 {
+		t.Errorf("%d requests", len(s.Requests()))
+	}
+}
+
+// once output has been streamed, a retry would repeat it, so a dropped
+// stream fails, where a dropped whole response is retried
+func TestNoRetryAfterStreaming(t *testing.T) {
+	for _, provider := range []string{OpenAIProvider, AnthropicProvider} {
+		t.Run(provider, func(t *testing.T) {
+			useFakeClock(t)
+			replies := []fake.Reply{{Content: "partial answer", Drop: true}, {Content: "whole answer"}}
+
+			client, s := retrying(t, provider, RetryPolicy{}, replies...)
+			r := hi()
+			var streamed strings.Builder
+			r.Stream = &streamed
+			if _, err := client.Complete(r); err == nil {
+				t.Error("no error for a dropped stream")
+			}
+			if streamed.String() != "partial answer" || len(s.Requests()) != 1 {
+				t.Errorf("streamed %q in %d requests", streamed.String(), len(s.Requests()))
+			}
+
+			client, s = retrying(t, provider, RetryPolicy{}, replies...)
+			resp, err := client.Complete(hi())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Content != "whole answer" || len(s.Requests()) != 2 {
+				t.Errorf("got %q in %d requests", resp.Content, len(s.Requests()))
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Transcription is a transcript, with the times of its segments
+type Transcription struct {
+	Text     string    `json:"text"`
+	Language string    `json:"language,omitempty"`
+	Duration float64   `json:"duration"` // in seconds
+	Segments []Segment `json:"segments"` // in order
+}
+
+// Segment is a stretch of a transcript
+type Segment struct {
+	Start float64 `json:"start"` // seconds from the start of the file
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcriber is implemented by clients and providers that can transcribe
+// with timestamps. the request's Options.Format is unused.
+type Transcriber interface {
+	Transcribe(ctx context.Context, r TranscriptionRequest) (*Transcription, error)
+}
+
+// Decoder decodes audio or video into wav, e.g. by running ffmpeg, so that
+// files too long for one upload can be split
+type Decoder func(ctx context.Context, f AVFile) (AVFile, error)
+
+// Segmentation splits files too large for one transcription upload into
+// overlapping segments, transcribed concurrently and stitched together. wav
+// files are split in pure go, after reducing them to 16kHz mono.
+type Segmentation struct {
+	MaxBytes    int           // per upload; if zero, 24MB, under whisper's limit of 25MB
+	Overlap     time.Duration // of consecutive segments, so words at the cuts aren't lost; if zero, 2s
+	Concurrency int           // segments transcribed at once; if zero, 4
+	Decoder     Decoder       // for large files other than wav, which fail if nil
+}
+
+func (s Segmentation) withDefaults() Segmentation {
+	if s.MaxBytes <= 0 {
+		s.MaxBytes = 24 << 20
+	}
+	if s.Overlap <= 0 {
+		s.Overlap = 2 * time.Second
+	}
+	if s.Concurrency <= 0 {
+		s.Concurrency = 4
+	}
+	return s
+}
+
+// transcribe transcribes a file, splitting it if it's too large. segment
+// times are fetched if verbose, or the requested format needs them.
+func transcribe(ctx context.Context, c OpenAI, r TranscriptionRequest, s Segmentation, verbose bool) (*Transcription, error) {
+	if err := r.Options.Format.check(); err != nil {
+		return nil, err
+	}
+	verbose = verbose || r.Options.Format.timed()
+	s = s.withDefaults()
+	if len(r.File.Content) <= s.MaxBytes {
+		return transcribeOne(ctx, c, r, verbose)
+	}
+	f := r.File
+	if f.ContentType != "audio/wav" && f.ContentType != "audio/x-wav" {
+		if s.Decoder == nil {
+			return nil, fmt.Errorf("%s file of %d bytes is over the upload limit of %d, and needs a Decoder to be split", f.ContentType, len(f.Content), s.MaxBytes)
+		}
+		var err error
+		f, err = s.Decoder(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode %s: %w", r.File.ContentType, err)
+		}
+	}
+	w, err := parseWAV(f.Content)
+	if err != nil {
+		return nil, err
+	}
+	w = w.speech()
+	pieces := split(w, s)
+	results := make([]*Transcription, len(pieces))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var first error // the failure that cancelled the rest
+	var once sync.Once
+	sem := make(chan struct{}, s.Concurrency)
+	var wg sync.WaitGroup
+	// started in order, so that the first segments are transcribed first:
+	for i, p := range pieces {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			once.Do(func() { first = ctx.Err() })
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			q := r
+			q.File = AVFile{ContentType: "audio/wav", Content: p.data}
+			var err error
+			results[i], err = transcribeOne(ctx, c, q, true)
+			if err != nil {
+				once.Do(func() {
+					first = fmt.Errorf("segment %d of %d: %w", i+1, len(pieces), err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if first != nil {
+		return nil, first
+	}
+	out := stitch(pieces, results, s.Overlap.Seconds())
+	out.Duration = float64(w.frames()) / float64(w.rate)
+	return out, nil
+}
+
+// piece is a segment of audio to transcribe
+type piece struct {
+	start float64 // in seconds
+	data  []byte  // a wav file
+}
+
+// split cuts audio into wav files of at most s.MaxBytes, overlapping by s.Overlap
+func split(w *wav, s Segmentation) []piece {
+	per := max((s.MaxBytes-44)/w.frameSize(), 1)
+	overlap := min(int(s.Overlap.Seconds()*float64(w.rate)), per/2)
+	var out []piece
+	for from := 0; ; from += per - overlap {
+		to := min(from+per, w.frames())
+		out = append(out, piece{start: float64(from) / float64(w.rate), data: w.encode(from, to)})
+		if to == w.frames() {
+			return out
+		}
+	}
+}
+
+// stitch joins the transcriptions of overlapping pieces, cutting in the
+// middle of each overlap. without segment times, the overlap is found by
+// matching words.
+func stitch(pieces []piece, results []*Transcription, overlap float64) *Transcription {
+	out := new(Transcription)
+	timed := true
+	var texts []string
+	for i, t := range results {
+		if len(out.Language) == 0 {
+			out.Language = t.Language
+		}
+		texts = append(texts, t.Text)
+		if len(t.Segments) == 0 {
+			timed = timed && len(strings.TrimSpace(t.Text)) == 0 // silence has no segments
+			continue
+		}
+		from, to := 0.0, -1.0 // the part of this piece to keep, in file time
+		if i > 0 {
+			from = pieces[i].start + overlap/2
+		}
+		if i+1 < len(pieces) {
+			to = pieces[i+1].start + overlap/2
+		}
+		for _, s := range t.Segments {
+			s.Start += pieces[i].start
+			s.End += pieces[i].start
+			middle := (s.Start + s.End) / 2
+			if middle < from || to >= 0 && middle >= to {
+				continue
+			}
+			out.Segments = append(out.Segments, s)
+		}
+	}
+	if timed {
+		var parts []string
+		for _, s := range out.Segments {
+			if t := strings.TrimSpace(s.Text); len(t) > 0 {
+				parts = append(parts, t)
+			}
+		}
+		out.Text = strings.Join(parts, " ")
+		return out
+	}
+	for _, t := range texts {
+		out.Text = mergeWords(out.Text, t)
+	}
+	return out
+}
+
+// mergeWords appends text to a transcript, dropping the words they share
+// where they overlap
+func mergeWords(a, b string) string {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if len(a) == 0 || len(b) == 0 {
+		return a + b
+	}
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	key := func(w string) string {
+		return strings.ToLower(strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }))
+	}
+	for k := min(len(wa), len(wb), 50); k >= 2; k-- {
+		match := true
+		for i := range k {
+			if key(wa[len(wa)-k+i]) != key(wb[i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return strings.TrimSpace(a + " " + strings.Join(wb[k:], " "))
+		}
+	}
+	return a + " " + b
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplit(t *testing.T) {
+	// ten seconds of 16kHz mono, 32000 bytes a second:
+	w := &wav{channels: 1, rate: 16000, bits: 16, data: make([]byte, 320000)}
+	for _, c := range []struct {
+		name     string
+		s        Segmentation
+		starts   []float64
+		lastSize int // in frames
+	}{
+		{"whole", Segmentation{MaxBytes: 44 + 320000, Overlap: time.Second}, []float64{0}, 160000},
+		{"overlapping", Segmentation{MaxBytes: 44 + 4*32000, Overlap: time.Second}, []float64{0, 3, 6}, 64000},
+		// the overlap is at most half of each piece, so pieces advance:
+		{"overlap capped", Segmentation{MaxBytes: 44 + 2*32000, Overlap: time.Minute}, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8}, 32000},
+		{"tiny pieces", Segmentation{MaxBytes: 1, Overlap: time.Second}, nil, 1},
+	} {
+		pieces := split(w, c.s)
+		var starts []float64
+		frames := 0
+		for i, p := range pieces {
+			starts = append(starts, p.start)
+			pw, err := parseWAV(p.data)
+			if err != nil {
+				t.Fatalf("%s: piece %d: %v", c.name, i, err)
+			}
+			if len(p.data) > max(c.s.MaxBytes, 46) {
+				t.Errorf("%s: piece %d of %d bytes", c.name, i, len(p.data))
+			}
+			frames = pw.frames()
+		}
+		if c.starts != nil && !reflect.DeepEqual(starts, c.starts) {
+			t.Errorf("%s: pieces start at %v, want %v", c.name, starts, c.starts)
+		}
+		last := pieces[len(pieces)-1]
+		if end := last.start + float64(frames)/16000; frames != c.lastSize || end != 10 {
+			t.Errorf("%s: last piece of %d frames ends at %vs", c.name, frames, end)
+		}
+	}
+}
+
+func TestStitch(t *testing.T) {
+	// pieces of 10s overlapping by 2s, the seams at 9s and 17s:
+	pieces := []piece{{start: 0}, {start: 8}, {start: 16}}
+	for _, c := range []struct {
+		name    string
+		results []*Transcription
+		want    *Transcription
+	}{
+		{"timed",
+			[]*Transcription{
+				{Language: "english", Text: "one two three", Segments: []Segment{{0, 4, " one"}, {4, 8.6, " two"}, {8.6, 9.8, " three"}}},
+				{Text: "three four five", Segments: []Segment{{0.6, 1.8, " three"}, {1.8, 8.4, " four"}, {8.4, 10, " five"}}},
+				{Text: "five six", Segments: []Segment{{0.4, 2, " five"}, {2, 6, " six"}}},
+			},
+			&Transcription{Language: "english", Text: "one two three four five six", Segments: []Segment{
+				{0, 4, " one"}, {4, 8.6, " two"}, {8.6, 9.8, " three"}, {9.8, 16.4, " four"}, {16.4, 18, " five"}, {18, 22, " six"},
+			}}},
+		// silence has no segments, but doesn't untime the rest:
+		{"silence",
+			[]*Transcription{
+				{Text: "one", Segments: []Segment{{0, 3, "one"}}},
+				{Text: " "},
+				{Text: "two", Segments: []Segment{{4, 6, "two"}}},
+			},
+			&Transcription{Text: "one two", Segments: []Segment{{0, 3, "one"}, {20, 22, "two"}}}},
+		// without times, the words shared at the seams are dropped:
+		{"untimed",
+			[]*Transcription{{Text: "the quick brown fox"}, {Text: "Brown fox, jumps over"}, {Text: "jumps over the lazy dog."}},
+			&Transcription{Text: "the quick brown fox jumps over the lazy dog."}},
+	} {
+		if got := stitch(pieces, c.results, 2); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMergeWords(t *testing.T) {
+	for _, c := range []struct {
+		a, b, want string
+	}{
+		{"", "hello there", "hello there"},
+		{"hello there", " ", "hello there"},
+		{"we went to the", "to the shop", "we went to the shop"},
+		{"It was. The END", "the end. Then", "It was. The END Then"},
+		// one word in common could be chance:
+		{"a cat", "cat sat", "a cat cat sat"},
+		{"no overlap", "at all", "no overlap at all"},
+		// the whole of either:
+		{"same words", "same words", "same words"},
+	} {
+		if got := mergeWords(c.a, c.b); got != c.want {
+			t.Errorf("mergeWords(%q, %q) = %q, want %q", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"encoding/json"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// approximate token costs beyond the text itself, after openai's accounting
+const (
+	messageTokens = 4   // per message, for its role and delimiters
+	replyTokens   = 3   // priming the assistant's reply
+	imageTokens   = 765 // a typical high-detail image
+)
+
+// CountTokens estimates the tokens of text for the model, without its
+// tokenizer: a word per few characters, digits in threes as openai splits
+// them, one per symbol, and one per character of scripts written without
+// spaces. it errs high, adding a margin of a tenth, as the estimates size
+// requests to fit context windows and rate limits.
+func (m Model) CountTokens(text string) int {
+	perToken := 4 // characters in a typical english token
+	if m.Provider == AnthropicProvider {
+		perToken = 3
+	}
+	var n, word, digits int
+	space := false // just after whitespace, which joins a following word but not digits
+	flush := func() {
+		n += (word+perToken-1)/perToken + (digits+2)/3
+		word, digits = 0, 0
+	}
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsDigit(r):
+			if word > 0 {
+				flush()
+			}
+			if space {
+				n++
+			}
+			digits++
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			if digits > 0 {
+				flush()
+			}
+			word++
+		case unicode.IsLetter(r):
+			flush()
+			n++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			n++
+		}
+		space = unicode.IsSpace(r)
+	}
+	flush()
+	return n + (n+9)/10
+}
+
+// CountMessages approximates the prompt tokens of the messages
+func (m Model) CountMessages(messages []openai.ChatCompletionMessage) int {
+	n := replyTokens
+	for _, x := range messages {
+		n += messageTokens + m.CountTokens(x.Content)
+		for _, p := range x.MultiContent {
+			switch p.Type {
+			case openai.ChatMessagePartTypeImageURL:
+				n += imageTokens
+			default:
+				n += m.CountTokens(p.Text)
+			}
+		}
+		for _, c := range x.ToolCalls {
+			n += messageTokens + m.CountTokens(c.Function.Name) + m.CountTokens(c.Function.Arguments)
+		}
+	}
+	return n
+}
+
+// CountTools approximates the prompt tokens of tool definitions
+func (m Model) CountTools(tools []openai.Tool) int {
+	var n int
+	for _, t := range tools {
+		if t.Function == nil {
+			continue
+		}
+		buf, _ := json.Marshal(t.Function.Parameters)
+		n += messageTokens + m.CountTokens(t.Function.Name) + m.CountTokens(t.Function.Description) + m.CountTokens(string(buf))
+	}
+	return n
+}
+
+// CountRequest approximates the prompt tokens of a request
+func (m Model) CountRequest(r CompletionRequest) int {
+	n := m.CountMessages(r.Messages) + m.CountTools(r.Tools)
+	if r.Schema != nil {
+		buf, _ := r.Schema.MarshalJSON()
+		n += m.CountTokens(string(buf))
+	}
+	return n
+}
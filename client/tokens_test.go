@@ -0,0 +1,29 @@
+package client
+
+import "testing"
+
+func TestCountTokens(t *testing.T) {
+	gpt, claude := Model{Provider: OpenAIProvider}, Model{Provider: AnthropicProvider}
+	for _, c := range []struct {
+		text  string
+		known int // by openai's cl100k_base tokenizer
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"tiktoken is great!", 6},
+		{"2 + 2 = 4", 7},
+		{"1234567890", 4},
+		{"antidisestablishmentarianism", 6},
+		{"お誕生日おめでとう", 9},
+	} {
+		// never under, nor wildly over:
+		got := gpt.CountTokens(c.text)
+		if got < c.known || got > 2*c.known+1 {
+			t.Errorf("%q: estimated %d tokens, known to be %d", c.text, got, c.known)
+		}
+		if n := claude.CountTokens(c.text); n < got {
+			t.Errorf("%q: estimated %d tokens for claude, fewer than %d for gpt", c.text, n, got)
+		}
+	}
+}
@@ -3,16 +3,52 @@ package client
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"mime"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/sashabaranov/go-openai"
 )
 
 type TranscriptionRequest struct {
-	Prompt string
-	File   AVFile
+	Prompt  string
+	File    AVFile
+	Options TranscriptionOptions
+}
+
+// TranscriptionOptions tune a transcription; the zero value transcribes with
+// whisper-1 into plain text, in the language spoken
+type TranscriptionOptions struct {
+	Model       string              // if empty, whisper-1
+	Language    string              // spoken, in ISO-639-1 like "de", to help recognition; if empty, detected
+	Translate   bool                // into english, rather than transcribing; Language is then unused
+	Temperature *float32            // of sampling, from 0 to 1; if nil, the api's default
+	Format      TranscriptionFormat // of the text returned by TranscribeAV; if empty, plain text
+}
+
+// TranscriptionFormat is the form of the text of a transcription
+type TranscriptionFormat string
+
+const (
+	TranscriptionText        TranscriptionFormat = "text"
+	TranscriptionSRT         TranscriptionFormat = "srt"          // subtitles
+	TranscriptionVTT         TranscriptionFormat = "vtt"          // web subtitles
+	TranscriptionVerboseJSON TranscriptionFormat = "verbose_json" // a Transcription, as json
+)
+
+// timed is whether a format needs the times of segments
+func (f TranscriptionFormat) timed() bool {
+	return f == TranscriptionSRT || f == TranscriptionVTT || f == TranscriptionVerboseJSON
+}
+
+func (f TranscriptionFormat) check() error {
+	switch f {
+	case "", TranscriptionText, TranscriptionSRT, TranscriptionVTT, TranscriptionVerboseJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown transcription format %q", f)
 }
 
 type AVFile struct {
@@ -22,6 +58,54 @@ type AVFile struct {
 
 // transcribes the audio of various multimedia files
 func TranscribeAV(c OpenAI, r TranscriptionRequest) (string, error) {
+	return TranscribeAVContext(context.Background(), c, r)
+}
+
+// TranscribeAVContext is like TranscribeAV, but aborts when ctx is done. long
+// wav files are split, per the default Segmentation.
+func TranscribeAVContext(ctx context.Context, c OpenAI, r TranscriptionRequest) (string, error) {
+	t, err := transcribe(ctx, c, r, Segmentation{}, false)
+	if err != nil {
+		return "", err
+	}
+	return render(t, r.Options.Format)
+}
+
+// render writes a transcription in a format. subtitles are written here,
+// rather than by the api, so that those of segmented files are stitched too.
+func render(t *Transcription, f TranscriptionFormat) (string, error) {
+	switch f {
+	case TranscriptionSRT, TranscriptionVTT:
+		var out strings.Builder
+		if f == TranscriptionVTT {
+			out.WriteString("WEBVTT\n\n")
+		}
+		for i, s := range t.Segments {
+			if f == TranscriptionSRT {
+				fmt.Fprintf(&out, "%d\n", i+1)
+			}
+			fmt.Fprintf(&out, "%s --> %s\n%s\n\n", cue(s.Start, f), cue(s.End, f), strings.TrimSpace(s.Text))
+		}
+		return out.String(), nil
+	case TranscriptionVerboseJSON:
+		b, err := json.Marshal(t)
+		return string(b), err
+	}
+	return t.Text, nil
+}
+
+// cue formats a time for subtitles, like 00:01:05,250 for srt or 00:01:05.250 for vtt
+func cue(seconds float64, f TranscriptionFormat) string {
+	ms := int64(seconds*1000 + 0.5)
+	sep := ","
+	if f == TranscriptionVTT {
+		sep = "."
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// extension returns the file name extension whisper needs to tell the format
+func extension(contentType string) (string, error) {
 	validWhisperExtensions := map[string]bool{
 		".m4a":  true,
 		".mp3":  true,
@@ -31,31 +115,55 @@ func TranscribeAV(c OpenAI, r TranscriptionRequest) (string, error) {
 		".wav":  true,
 		".mpeg": true,
 	}
-	exts, err := mime.ExtensionsByType(r.File.ContentType)
+	exts, err := mime.ExtensionsByType(contentType)
 	if err != nil {
 		return "", err
 	}
-	var fileExtension string
 	for _, e := range exts {
 		if validWhisperExtensions[e] {
-			fileExtension = e
-			break
+			return e, nil
 		}
 	}
-	if len(fileExtension) == 0 {
-		return "", fmt.Errorf("no file extension found for content type %q", r.File.ContentType)
+	return "", fmt.Errorf("no file extension found for content type %q", contentType)
+}
+
+// transcribeOne transcribes a file in one upload, with segment times if verbose
+func transcribeOne(ctx context.Context, c OpenAI, r TranscriptionRequest, verbose bool) (*Transcription, error) {
+	fileExtension, err := extension(r.File.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	o := r.Options
+	req := openai.AudioRequest{
+		Model:    o.Model,
+		FilePath: uuid.NewString() + fileExtension, // just needed for the extension
+		Prompt:   r.Prompt,
+		Reader:   bytes.NewReader(r.File.Content),
+	}
+	if len(req.Model) == 0 {
+		req.Model = openai.Whisper1
+	}
+	if o.Temperature != nil {
+		req.Temperature = *o.Temperature
+	}
+	if verbose {
+		req.Format = openai.AudioResponseFormatVerboseJSON
 	}
-	t, err := c.CreateTranscription(context.Background(), openai.AudioRequest{
-		Model:       openai.Whisper1,
-		FilePath:    uuid.NewString() + fileExtension, // just needed for the extension
-		Prompt:      r.Prompt,
-		Reader:      bytes.NewReader(r.File.Content),
-		Temperature: 1,
-	})
+	create := c.CreateTranscription
+	if o.Translate {
+		create = c.CreateTranslation
+	} else {
+		req.Language = o.Language
+	}
+	t, err := create(ctx, req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return t.Text, nil
+	out := &Transcription{Text: t.Text, Language: t.Language, Duration: t.Duration}
+	for _, s := range t.Segments {
+		out.Segments = append(out.Segments, Segment{Start: s.Start, End: s.End, Text: s.Text})
+	}
+	return out, nil
 }
 
 func init() {
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// wav is pcm audio parsed from a wav file
+type wav struct {
+	channels int
+	rate     int // frames per second
+	bits     int // per sample
+	float    bool
+	data     []byte // interleaved samples
+}
+
+func (w wav) frameSize() int {
+	return w.channels * w.bits / 8
+}
+
+func (w wav) frames() int {
+	return len(w.data) / w.frameSize()
+}
+
+// parseWAV reads the pcm or float audio of a wav file
+func parseWAV(b []byte) (*wav, error) {
+	if len(b) < 12 || string(b[:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a wav file")
+	}
+	var w wav
+	var format int
+	for pos := 12; pos+8 <= len(b); {
+		id, size := string(b[pos:pos+4]), int(binary.LittleEndian.Uint32(b[pos+4:pos+8]))
+		pos += 8
+		end := min(pos+size, len(b)) // data sizes of streamed recordings are often wrong
+		switch id {
+		case "fmt ":
+			if size < 16 || pos+16 > len(b) {
+				return nil, fmt.Errorf("bad wav format chunk")
+			}
+			format = int(binary.LittleEndian.Uint16(b[pos:]))
+			w.channels = int(binary.LittleEndian.Uint16(b[pos+2:]))
+			w.rate = int(binary.LittleEndian.Uint32(b[pos+4:]))
+			w.bits = int(binary.LittleEndian.Uint16(b[pos+14:]))
+			if format == 0xfffe && size >= 26 && pos+26 <= len(b) {
+				format = int(binary.LittleEndian.Uint16(b[pos+24:])) // the extensible format's subformat
+			}
+		case "data":
+			if size == 0 || size == math.MaxUint32 {
+				end = len(b)
+			}
+			w.data = b[pos:end]
+		}
+		pos += size + size%2
+		if w.data != nil && w.channels > 0 {
+			break
+		}
+	}
+	switch {
+	case w.channels == 0 || w.rate == 0:
+		return nil, fmt.Errorf("wav file has no format")
+	case w.data == nil:
+		return nil, fmt.Errorf("wav file has no data")
+	case format == 1 && (w.bits == 8 || w.bits == 16 || w.bits == 24 || w.bits == 32):
+	case format == 3 && w.bits == 32:
+		w.float = true
+	default:
+		return nil, fmt.Errorf("unsupported wav encoding %d with %d bits", format, w.bits)
+	}
+	w.data = w.data[:len(w.data)/w.frameSize()*w.frameSize()]
+	return &w, nil
+}
+
+// sample returns a frame's channels mixed, from -1 to 1
+func (w wav) sample(frame int) float64 {
+	var sum float64
+	size := w.bits / 8
+	for c := range w.channels {
+		s := w.data[frame*w.frameSize()+c*size:]
+		switch {
+		case w.float:
+			sum += float64(math.Float32frombits(binary.LittleEndian.Uint32(s)))
+		case w.bits == 8:
+			sum += (float64(s[0]) - 128) / 128
+		case w.bits == 16:
+			sum += float64(int16(binary.LittleEndian.Uint16(s))) / (1 << 15)
+		case w.bits == 24:
+			sum += float64(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)>>8) / (1 << 23)
+		case w.bits == 32:
+			sum += float64(int32(binary.LittleEndian.Uint32(s))) / (1 << 31)
+		}
+	}
+	return sum / float64(w.channels)
+}
+
+// speech converts audio to 16-bit mono at no more than 16kHz, all speech
+// recognition needs, shrinking uploads
+func (w *wav) speech() *wav {
+	rate := min(w.rate, 16000)
+	if w.channels == 1 && w.bits == 16 && !w.float && rate == w.rate {
+		return w
+	}
+	n := int(int64(w.frames()) * int64(rate) / int64(w.rate))
+	out := &wav{channels: 1, rate: rate, bits: 16, data: make([]byte, 2*n)}
+	last := w.frames() - 1
+	for j := range n {
+		// linear interpolation, without filtering, is good enough for speech:
+		p := float64(j) * float64(w.rate) / float64(rate)
+		i := int(p)
+		s := w.sample(min(i, last))
+		if i < last {
+			s += (w.sample(i+1) - s) * (p - float64(i))
+		}
+		v := int16(max(-1, min(s, 1-1.0/(1<<15))) * (1 << 15))
+		binary.LittleEndian.PutUint16(out.data[2*j:], uint16(v))
+	}
+	return out
+}
+
+// encode writes a range of frames as a wav file
+func (w wav) encode(from, to int) []byte {
+	data := w.data[from*w.frameSize() : to*w.frameSize()]
+	format := 1
+	if w.float {
+		format = 3
+	}
+	b := make([]byte, 44, 44+len(data))
+	copy(b, "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], uint32(36+len(data)))
+	copy(b[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], uint16(format))
+	binary.LittleEndian.PutUint16(b[22:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(b[24:], uint32(w.rate))
+	binary.LittleEndian.PutUint32(b[28:], uint32(w.rate*w.frameSize()))
+	binary.LittleEndian.PutUint16(b[32:], uint16(w.frameSize()))
+	binary.LittleEndian.PutUint16(b[34:], uint16(w.bits))
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], uint32(len(data)))
+	return append(b, data...)
+}
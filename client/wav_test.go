@@ -0,0 +1,168 @@
+package client
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// chunk is a riff chunk, its size written as declared
+func chunk(id string, size uint32, body []byte) []byte {
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, size)...)
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// format is the body of a fmt chunk
+func format(encoding, channels, rate, bits int) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, uint16(encoding))
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate*channels*bits/8))
+	b = binary.LittleEndian.AppendUint16(b, uint16(channels*bits/8))
+	return binary.LittleEndian.AppendUint16(b, uint16(bits))
+}
+
+func riff(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))...), append([]byte("WAVE"), body...)...)
+}
+
+func TestParseWAV(t *testing.T) {
+	pcm := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	fmt16 := chunk("fmt ", 16, format(1, 2, 8000, 16))
+	extensible := append(format(0xfffe, 1, 8000, 16), 22, 0, 16, 0, 4, 0, 0, 0)
+	extensible = append(extensible, binary.LittleEndian.AppendUint16(nil, 1)...)
+	extensible = append(extensible, make([]byte, 14)...)
+	for _, c := range []struct {
+		name     string
+		file     []byte
+		err      string
+		channels int
+		bits     int
+		float    bool
+		data     int
+	}{
+		{name: "empty", file: nil, err: "not a wav file"},
+		{name: "not riff", file: []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00"), err: "not a wav file"},
+		{name: "header only", file: []byte("RIFF\x04\x00\x00\x00WAVE"), err: "no format"},
+		{name: "truncated chunk header", file: append(riff(), "fmt \x10\x00"...), err: "no format"},
+		{name: "truncated format", file: append(riff(), "fmt \x10\x00\x00\x00\x01\x00\x01\x00"...), err: "bad wav format chunk"},
+		{name: "short format", file: riff(chunk("fmt ", 8, format(1, 1, 8000, 16)[:8])), err: "bad wav format chunk"},
+		{name: "no data", file: riff(fmt16), err: "no data"},
+		{name: "data before format only", file: riff(chunk("data", 8, pcm)), err: "no format"},
+		{name: "adpcm", file: riff(chunk("fmt ", 16, format(2, 1, 8000, 4)), chunk("data", 8, pcm)), err: "unsupported wav encoding 2 with 4 bits"},
+		{name: "12 bits", file: riff(chunk("fmt ", 16, format(1, 1, 8000, 12)), chunk("data", 8, pcm)), err: "unsupported wav encoding 1 with 12 bits"},
+		{name: "double", file: riff(chunk("fmt ", 16, format(3, 1, 8000, 64)), chunk("data", 8, pcm)), err: "unsupported wav encoding 3 with 64 bits"},
+		{name: "pcm", file: riff(fmt16, chunk("data", 8, pcm)), channels: 2, bits: 16, data: 8},
+		{name: "float", file: riff(chunk("fmt ", 16, format(3, 1, 8000, 32)), chunk("data", 8, pcm)), channels: 1, bits: 32, float: true, data: 8},
+		{name: "extensible pcm", file: riff(chunk("fmt ", 40, extensible), chunk("data", 8, pcm)), channels: 1, bits: 16, data: 8},
+		// odd chunks are padded, and unknown ones skipped:
+		{name: "other chunks", file: riff(chunk("LIST", 3, []byte("abc")), fmt16, chunk("data", 8, pcm)), channels: 2, bits: 16, data: 8},
+		// streamed recordings don't know their length:
+		{name: "unknown length", file: riff(fmt16, chunk("data", math.MaxUint32, pcm)), channels: 2, bits: 16, data: 8},
+		{name: "zero length", file: riff(fmt16, chunk("data", 0, pcm)), channels: 2, bits: 16, data: 8},
+		{name: "overlong", file: riff(fmt16, chunk("data", 800, pcm)), channels: 2, bits: 16, data: 8},
+		// partial frames are dropped:
+		{name: "partial frame", file: riff(fmt16, chunk("data", 7, pcm[:7])), channels: 2, bits: 16, data: 4},
+	} {
+		w, err := parseWAV(c.file)
+		switch {
+		case len(c.err) > 0:
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: got %v, want %q", c.name, err, c.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		case w.channels != c.channels || w.bits != c.bits || w.float != c.float || w.rate != 8000 || len(w.data) != c.data:
+			t.Errorf("%s: got %d channels of %d bits (float %v) at %d, %d bytes", c.name, w.channels, w.bits, w.float, w.rate, len(w.data))
+		}
+	}
+}
+
+// samples encodes frames of channels as pcm or float samples
+func samples(bits int, float bool, frames ...[]float64) []byte {
+	var b []byte
+	for _, f := range frames {
+		for _, s := range f {
+			switch {
+			case float:
+				b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(s)))
+			case bits == 8:
+				b = append(b, byte(128+s*128))
+			case bits == 16:
+				b = binary.LittleEndian.AppendUint16(b, uint16(int16(s*(1<<15))))
+			case bits == 24:
+				v := uint32(int32(s * (1 << 23)))
+				b = append(b, byte(v), byte(v>>8), byte(v>>16))
+			case bits == 32:
+				b = binary.LittleEndian.AppendUint32(b, uint32(int32(s*(1<<31))))
+			}
+		}
+	}
+	return b
+}
+
+func TestSpeech(t *testing.T) {
+	// a half-amplitude square wave, changing every frame of the output:
+	wave := func(rate, channels int) [][]float64 {
+		var frames [][]float64
+		for i := range rate / 100 {
+			s := 0.5
+			if i*16000/rate%2 == 1 {
+				s = -0.5
+			}
+			f := make([]float64, channels)
+			for c := range f {
+				f[c] = s
+			}
+			frames = append(frames, f)
+		}
+		return frames
+	}
+	for _, c := range []struct {
+		name                 string
+		rate, channels, bits int
+		float                bool
+		wantRate, wantFrames int
+		same                 bool
+	}{
+		{"already speech", 16000, 1, 16, false, 16000, 160, true},
+		{"8kHz 8 bits", 8000, 1, 8, false, 8000, 80, false},
+		{"44.1kHz stereo 16 bits", 44100, 2, 16, false, 16000, 160, false},
+		{"48kHz 24 bits", 48000, 1, 24, false, 16000, 160, false},
+		{"32kHz 32 bits", 32000, 2, 32, false, 16000, 160, false},
+		{"48kHz float", 48000, 2, 32, true, 16000, 160, false},
+	} {
+		w := &wav{channels: c.channels, rate: c.rate, bits: c.bits, float: c.float, data: samples(c.bits, c.float, wave(c.rate, c.channels)...)}
+		s := w.speech()
+		if s.channels != 1 || s.bits != 16 || s.float || s.rate != c.wantRate || s.frames() != c.wantFrames || (s == w) != c.same {
+			t.Errorf("%s: got %d channels of %d bits at %d, %d frames", c.name, s.channels, s.bits, s.rate, s.frames())
+			continue
+		}
+		for i := range s.frames() {
+			want := 0.5
+			if i*16000/s.rate%2 == 1 {
+				want = -0.5
+			}
+			// other rates interpolate across the edges of the wave:
+			if got := s.sample(i); math.Abs(got-want) > 0.01 && c.rate%16000 == 0 {
+				t.Errorf("%s: frame %d is %v, want %v", c.name, i, got, want)
+				break
+			}
+		}
+	}
+	// channels are mixed:
+	w := &wav{channels: 2, rate: 16000, bits: 16, data: samples(16, false, []float64{0.5, -0.25}, []float64{-1, -1})}
+	s := w.speech()
+	if got := []float64{s.sample(0), s.sample(1)}; got[0] != 0.125 || got[1] != -1 {
+		t.Errorf("mixed to %v", got)
+	}
+}
@@ -0,0 +1,324 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"xoba.com/llm/cache"
+	"xoba.com/llm/client"
+	"xoba.com/llm/htmltext"
+	"xoba.com/llm/office"
+	"xoba.com/llm/pdf"
+	"xoba.com/llm/sniff"
+)
+
+// Converter turns a File into background material for the model
+type Converter interface {
+	Convert(ctx context.Context, x *Conversion, f File) ([]Part, error)
+}
+
+// ConverterFunc makes a Converter of a function
+type ConverterFunc func(ctx context.Context, x *Conversion, f File) ([]Part, error)
+
+func (c ConverterFunc) Convert(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	return c(ctx, x, f)
+}
+
+// Part is converted material: text, an image, or both
+type Part struct {
+	Name  string // of the file it came from
+	Label string // introduces the part to the model, e.g. `here is a text/csv file named "x.csv"`
+	Text  string
+	Image *File // shown to models which take images
+}
+
+// TextPart is a part of a file's text, labelled with the intro (formatted
+// with the file's content type and name)
+func TextPart(f File, intro, text string) Part {
+	return Part{Name: f.Name, Label: fmt.Sprintf(intro, f.ContentType, f.Name), Text: text}
+}
+
+// ImagePart shows an image file
+func ImagePart(f File) Part {
+	return Part{Name: f.Name, Label: fmt.Sprintf("here is an %s file named %q", f.ContentType, f.Name), Image: &f}
+}
+
+// Conversion is what converters may use while converting a question's files
+type Conversion struct {
+	Client     client.Interface
+	PDF        func(ctx context.Context, data []byte) ([]pdf.Page, error) // never nil
+	converters map[string]Converter                                       // the question's overrides
+	events     emitter
+	expansion  *expansion
+}
+
+// Emit reports progress to the question's event callback
+func (x *Conversion) Emit(e Event) {
+	x.events.emit(e)
+}
+
+// Converter finds the converter for a content type, preferring the question's
+// overrides to the registered ones
+func (x *Conversion) Converter(contentType string) (Converter, bool) {
+	if c, ok := x.converters[contentType]; ok && c != nil {
+		return c, true
+	}
+	return LookupConverter(contentType)
+}
+
+// Convert converts a file with the converter for its content type, so
+// converters can delegate
+func (x *Conversion) Convert(ctx context.Context, f File) ([]Part, error) {
+	f, c, err := x.identify(f)
+	if err != nil {
+		return nil, err
+	}
+	return c.Convert(ctx, x, f)
+}
+
+// identify returns the file with its content type corrected, and its
+// converter. the declared type is normalized, but if it's missing,
+// unsupported, or contradicted by the file's signature, it's detected.
+func (x *Conversion) identify(f File) (File, Converter, error) {
+	declared := sniff.Normalize(f.ContentType)
+	// signatures of audio and video are short enough to occur in text by
+	// chance, so they never override a declared text type:
+	text := sniff.Text(declared)
+	media := func(t string) bool {
+		return strings.HasPrefix(t, "audio/") || strings.HasPrefix(t, "video/")
+	}
+	if magic := sniff.Magic(f.Content); len(magic) > 0 && magic != declared && !(text && media(magic)) {
+		if c, ok := x.Converter(magic); ok {
+			f.ContentType = magic
+			return f, c, nil
+		}
+	}
+	if !sniff.Generic(declared) {
+		// the original spelling first, in case it has its own converter:
+		if c, ok := x.Converter(f.ContentType); ok {
+			return f, c, nil
+		}
+		if c, ok := x.Converter(declared); ok {
+			f.ContentType = declared
+			return f, c, nil
+		}
+	}
+	detected := sniff.Detect(f.Name, f.Content)
+	if c, ok := x.Converter(detected); ok && !(text && media(detected)) {
+		f.ContentType = detected
+		return f, c, nil
+	}
+	return f, nil, fmt.Errorf("%q: declared %q, detected %q", f.Name, f.ContentType, detected)
+}
+
+// check returns an error naming every file without a converter
+func (x *Conversion) check(files []File) error {
+	var bad []string
+	for _, f := range files {
+		if _, _, err := x.identify(f); err != nil {
+			bad = append(bad, err.Error())
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("unsupported content type of %s", strings.Join(bad, "; "))
+	}
+	return nil
+}
+
+var converters struct {
+	sync.RWMutex
+	m map[string]Converter
+}
+
+// RegisterConverter adds a converter for content types, replacing any already registered
+func RegisterConverter(c Converter, contentTypes ...string) {
+	converters.Lock()
+	defer converters.Unlock()
+	if converters.m == nil {
+		converters.m = make(map[string]Converter)
+	}
+	for _, t := range contentTypes {
+		converters.m[t] = c
+	}
+}
+
+// LookupConverter finds the registered converter for a content type
+func LookupConverter(contentType string) (Converter, bool) {
+	converters.RLock()
+	defer converters.RUnlock()
+	c, ok := converters.m[contentType]
+	return c, ok
+}
+
+// ContentTypes lists the content types with registered converters, sorted
+func ContentTypes() []string {
+	converters.RLock()
+	defer converters.RUnlock()
+	var out []string
+	for t := range converters.m {
+		out = append(out, t)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func init() {
+	RegisterConverter(ConverterFunc(transcribe),
+		"audio/mp3", "audio/mp4", "audio/mpeg", "audio/wav", "audio/x-wav", "audio/webm", "video/mp4", "video/mpeg", "video/webm")
+	RegisterConverter(ConverterFunc(extractPDF), "application/pdf")
+	RegisterConverter(ConverterFunc(plainText),
+		"application/json",
+		"text/plain", "text/markdown", "text/csv", "text/xml", "text/rtf",
+		"text/tab-separated-values", "text/richtext",
+		"text/yaml", "text/x-yaml", "text/x-markdown", "text/x-rst", "text/x-org")
+	RegisterConverter(ConverterFunc(showImage), "image/png", "image/jpeg", "image/webp", "image/gif")
+	RegisterConverter(ConverterFunc(webPage), "text/html")
+	RegisterConverter(ConverterFunc(wordProcessor), office.DOCXType, office.ODTType)
+	RegisterConverter(ConverterFunc(spreadsheet), office.XLSXType)
+	RegisterConverter(ConverterFunc(presentation), office.PPTXType)
+}
+
+func transcribe(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	x.Emit(Event{Type: EventTranscriptionStarted, File: f.Name})
+	r := client.TranscriptionRequest{
+		File:    client.AVFile{ContentType: f.ContentType, Content: f.Content},
+		Options: f.Transcription,
+	}
+	what := "transcription"
+	if r.Options.Translate {
+		what = "english translation"
+	}
+	var txt, intro string
+	if f.Timestamps {
+		tr, ok := x.Client.(client.Transcriber)
+		if !ok {
+			return nil, fmt.Errorf("%s client can't transcribe with timestamps: %w", x.Client.Provider(), client.ErrUnsupported)
+		}
+		t, err := tr.Transcribe(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		txt = timestamped(t)
+		intro = "here is the " + what + " of a %s file named %q, each segment headed by its start and end times"
+	} else {
+		var err error
+		txt, err = x.Client.TranscribeAVContext(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		switch r.Options.Format {
+		case client.TranscriptionSRT, client.TranscriptionVTT:
+			what += fmt.Sprintf(", as %s subtitles,", r.Options.Format)
+		case client.TranscriptionVerboseJSON:
+			what += ", as json,"
+		}
+		intro = "here is the " + what + " of a %s file named %q"
+	}
+	x.Emit(Event{Type: EventTranscriptionFinished, File: f.Name, Text: txt})
+	return []Part{TextPart(f, intro, txt)}, nil
+}
+
+// timestamped formats a transcription a segment per line, like "[00:01:05-00:01:09] text"
+func timestamped(t *client.Transcription) string {
+	if len(t.Segments) == 0 {
+		return t.Text
+	}
+	clock := func(seconds float64) string {
+		s := int(seconds)
+		return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	var out strings.Builder
+	for _, s := range t.Segments {
+		fmt.Fprintf(&out, "[%s-%s] %s\n", clock(s.Start), clock(s.End), strings.TrimSpace(s.Text))
+	}
+	return out.String()
+}
+
+func extractPDF(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	pages, err := x.PDF(ctx, f.Content)
+	if err != nil {
+		return nil, fmt.Errorf("can't extract text of %q: %w", f.Name, err)
+	}
+	return []Part{TextPart(f, "here is the text rendering of an %s file named %q, each page headed by its number", pdf.Text(pages))}, nil
+}
+
+// cachedPDF caches the pages extracted from pdf files, keyed by the
+// extractor's name and version too, since extractors differ
+func cachedPDF(c cache.Cache, extractor string, extract func(ctx context.Context, data []byte) ([]pdf.Page, error)) func(ctx context.Context, data []byte) ([]pdf.Page, error) {
+	return func(ctx context.Context, data []byte) ([]pdf.Page, error) {
+		key := cache.Key("pdf", data, extractor)
+		if b, ok := c.Get(key); ok {
+			var pages []pdf.Page
+			if json.Unmarshal(b, &pages) == nil {
+				return pages, nil
+			}
+		}
+		pages, err := extract(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		if b, err := json.Marshal(pages); err == nil {
+			c.Put(key, b) // failing to cache is no failure
+		}
+		return pages, nil
+	}
+}
+
+func plainText(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	return []Part{TextPart(f, "here is a %s file named %q", string(f.Content))}, nil
+}
+
+func webPage(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	txt, err := htmltext.Markdown(f.Content)
+	if err != nil {
+		return nil, fmt.Errorf("can't convert html of %q: %w", f.Name, err)
+	}
+	return []Part{TextPart(f, "here is the text of a %s file named %q, as markdown", txt)}, nil
+}
+
+func wordProcessor(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	extract := office.DOCX
+	if f.ContentType == office.ODTType {
+		extract = office.ODT
+	}
+	txt, err := extract(f.Content)
+	if err != nil {
+		return nil, fmt.Errorf("can't extract text of %q: %w", f.Name, err)
+	}
+	return []Part{TextPart(f, "here is the text of an %s file named %q, with headings, lists and tables in markdown", txt)}, nil
+}
+
+func spreadsheet(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	sheets, err := office.XLSX(f.Content)
+	if err != nil {
+		return nil, fmt.Errorf("can't extract sheets of %q: %w", f.Name, err)
+	}
+	var out []string
+	for _, s := range sheets {
+		out = append(out, s.Markdown())
+	}
+	return []Part{TextPart(f, "here are the sheets of an %s file named %q, as markdown tables headed by sheet name", strings.Join(out, "\n"))}, nil
+}
+
+func presentation(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	slides, err := office.PPTX(f.Content)
+	if err != nil {
+		return nil, fmt.Errorf("can't extract slides of %q: %w", f.Name, err)
+	}
+	var out strings.Builder
+	for _, s := range slides {
+		fmt.Fprintf(&out, "[slide %d]\n%s\n\n", s.Number, s.Text)
+		if len(s.Notes) > 0 {
+			fmt.Fprintf(&out, "speaker notes:\n%s\n\n", s.Notes)
+		}
+	}
+	return []Part{TextPart(f, "here are the slides of an %s file named %q, each headed by its number, with any speaker notes", out.String())}, nil
+}
+
+func showImage(ctx context.Context, x *Conversion, f File) ([]Part, error) {
+	return []Part{ImagePart(f)}, nil
+}
@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"xoba.com/llm/cache"
+	"xoba.com/llm/pdf"
+)
+
+func TestIdentify(t *testing.T) {
+	x := &Conversion{}
+	for _, c := range []struct {
+		file File
+		want string
+	}{
+		{File{Name: "x.csv", ContentType: "text/csv", Content: []byte("\xff\xfea\x00,\x00b\x00")}, "text/csv"},
+		{File{Name: "x.txt", ContentType: "text/plain", Content: []byte("\xff\xfb\x90\x64 not audio")}, "text/plain"},
+		{File{Name: "x.csv", Content: []byte("\xff\xfea\x00,\x00b\x00")}, "text/csv"},
+		{File{Name: "x.mp3", ContentType: "application/octet-stream", Content: []byte("\xff\xfb\x90\x64....")}, "audio/mpeg"},
+		{File{Name: "x.txt", ContentType: "text/plain", Content: []byte("%PDF-1.4\n")}, "application/pdf"},
+		{File{Name: "x.jpg", ContentType: "image/jpg", Content: []byte("\xff\xd8\xff\xe0")}, "image/jpeg"},
+	} {
+		f, _, err := x.identify(c.file)
+		if err != nil {
+			t.Errorf("%s: %v", c.file.Name, err)
+			continue
+		}
+		if f.ContentType != c.want {
+			t.Errorf("%s declared %q: got %q, want %q", c.file.Name, c.file.ContentType, f.ContentType, c.want)
+		}
+	}
+}
+
+func TestCachedPDF(t *testing.T) {
+	store := cache.NewMemory(0)
+	var calls int
+	extractor := func(text string) func(context.Context, []byte) ([]pdf.Page, error) {
+		return func(context.Context, []byte) ([]pdf.Page, error) {
+			calls++
+			return []pdf.Page{{Number: 1, Text: text}}, nil
+		}
+	}
+	ctx := context.Background()
+	data := []byte("%PDF-1.4")
+	for _, c := range []struct {
+		version, text, want string
+		calls               int
+	}{
+		{"a 1", "first", "first", 1},
+		{"a 1", "second", "first", 1},  // cached
+		{"b 1", "third", "third", 2},   // another extractor
+		{"a 2", "fourth", "fourth", 3}, // another version
+	} {
+		pages, err := cachedPDF(store, c.version, extractor(c.text))(ctx, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pages[0].Text != c.want || calls != c.calls {
+			t.Errorf("%s: got %q after %d calls, want %q after %d", c.version, pages[0].Text, calls, c.want, c.calls)
+		}
+	}
+}
+
+func TestCachedPDFNeedsVersion(t *testing.T) {
+	q := Question[string]{Prompt: "hi", Cache: cache.NewMemory(0), PDF: pdf.Pdftotext}
+	if _, err := Ask(nil, q); err == nil || !strings.Contains(err.Error(), "PDFVersion") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+// package embedding embeds texts through any client that can, batching
+// requests and caching vectors
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"xoba.com/llm/client"
+)
+
+// Config tunes an Embedder
+type Config struct {
+	BatchSize int // texts per api call; if zero, 64
+	MaxCached int // vectors kept, evicting the oldest; if zero, 10000, if negative, none
+}
+
+// Embedder batches and caches a client's embeddings. it's safe for concurrent
+// use, and is itself a client.Embedder.
+type Embedder struct {
+	e      client.Embedder
+	config Config
+	mu     sync.Mutex
+	cache  map[string][]float32
+	order  []string // cached texts, oldest first
+	stats  Stats
+}
+
+// Stats counts texts served from the cache, or embedded by the api
+type Stats struct {
+	Hits, Misses int
+}
+
+// New wraps a client, which must be able to embed
+func New(c client.Interface, config Config) (*Embedder, error) {
+	e, ok := c.(client.Embedder)
+	if !ok {
+		return nil, fmt.Errorf("%s client can't embed: %w", c.Provider(), client.ErrUnsupported)
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 64
+	}
+	if config.MaxCached == 0 {
+		config.MaxCached = 10000
+	}
+	return &Embedder{
+		e:      e,
+		config: config,
+		cache:  make(map[string][]float32),
+	}, nil
+}
+
+// Embed returns a vector per text, in order
+func (e *Embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	var missing []string
+	need := make(map[string][]int) // missing text to its indexes
+	e.mu.Lock()
+	for i, t := range texts {
+		if v, ok := e.cache[t]; ok {
+			out[i] = v
+			e.stats.Hits++
+			continue
+		}
+		if _, ok := need[t]; !ok {
+			missing = append(missing, t)
+			e.stats.Misses++
+		}
+		need[t] = append(need[t], i)
+	}
+	e.mu.Unlock()
+	for len(missing) > 0 {
+		batch := missing[:min(e.config.BatchSize, len(missing))]
+		missing = missing[len(batch):]
+		vectors, err := e.e.Embed(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != len(batch) {
+			return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(batch))
+		}
+		for j, t := range batch {
+			for _, i := range need[t] {
+				out[i] = vectors[j]
+			}
+			e.remember(t, vectors[j])
+		}
+	}
+	return out, nil
+}
+
+func (e *Embedder) remember(text string, v []float32) {
+	if e.config.MaxCached < 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.cache[text]; ok {
+		return
+	}
+	e.cache[text] = v
+	e.order = append(e.order, text)
+	for len(e.order) > e.config.MaxCached {
+		delete(e.cache, e.order[0])
+		e.order = e.order[1:]
+	}
+}
+
+// Stats returns the cache statistics so far
+func (e *Embedder) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"xoba.com/llm/client"
+)
+
+//go:generate stringer -type=EventType
+type EventType int
+
+const (
+	_ EventType = iota
+	EventTokenDelta
+	EventToolCallStarted
+	EventToolArgumentsDelta
+	EventToolResult
+	EventRetry
+	EventTranscriptionStarted
+	EventTranscriptionFinished
+	EventFinalAnswer
+	EventHistoryTrimmed
+)
+
+// Event reports progress while asking a question, so UIs can render it
+type Event struct {
+	Type   EventType
+	Text   string // token or arguments delta, tool result, transcription, or what history was trimmed
+	Tool   string // name of the tool, for tool events
+	CallID string // id of the tool call, for tool events
+	File   string // name of the file, for transcription events
+	Err    error  // for EventRetry or a failed EventToolResult, what went wrong
+	Answer any    // for EventFinalAnswer, the *Answer[ANSWER]
+}
+
+// emitter sends events, doing nothing if there's no callback
+type emitter func(Event)
+
+func (e emitter) emit(event Event) {
+	if e != nil {
+		e(event)
+	}
+}
+
+// Write lets the emitter stream tokens
+func (e emitter) Write(p []byte) (int, error) {
+	e.emit(Event{Type: EventTokenDelta, Text: string(p)})
+	return len(p), nil
+}
+
+// toolDelta turns streamed tool call fragments into events
+func (e emitter) toolDelta(d client.ToolDelta) {
+	if len(d.Name) > 0 {
+		e.emit(Event{Type: EventToolCallStarted, Tool: d.Name, CallID: d.ID})
+	}
+	if len(d.Arguments) > 0 {
+		e.emit(Event{Type: EventToolArgumentsDelta, Text: d.Arguments, CallID: d.ID})
+	}
+}
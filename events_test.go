@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"xoba.com/llm/client/fake"
+)
+
+func TestEvents(t *testing.T) {
+	var types []EventType
+	var tokens, arguments strings.Builder
+	var results []Event
+	var final any
+	events := func(e Event) {
+		if len(types) == 0 || types[len(types)-1] != e.Type {
+			types = append(types, e.Type)
+		}
+		switch e.Type {
+		case EventTokenDelta:
+			tokens.WriteString(e.Text)
+		case EventToolArgumentsDelta:
+			arguments.WriteString(e.Text)
+		case EventToolResult:
+			results = append(results, e)
+		case EventFinalAnswer:
+			final = e.Answer
+		}
+	}
+	c, _ := asking(t, calls("halve", 4), answered)
+	resp, err := Ask(c, Question[string]{Prompt: "halves?", Tools: map[string]Tool{"halve": halve}, Events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []EventType{EventToolCallStarted, EventToolArgumentsDelta, EventToolResult, EventTokenDelta, EventFinalAnswer}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("events %v, want %v", types, want)
+	}
+	if arguments.String() != `{"n":4}` {
+		t.Errorf("streamed arguments %q", arguments.String())
+	}
+	if len(results) != 1 || results[0].Tool != "halve" || results[0].CallID != "call_halve_4" || results[0].Text != "2" || results[0].Err != nil {
+		t.Errorf("results %+v", results)
+	}
+	if tokens.String() != answered.Content {
+		t.Errorf("streamed %q", tokens.String())
+	}
+	if final != resp.Answer {
+		t.Errorf("final answer %v, want %v", final, resp.Answer)
+	}
+}
+
+// retries are reported, with what went wrong
+func TestRetryEvents(t *testing.T) {
+	var retries []error
+	events := func(e Event) {
+		if e.Type == EventRetry {
+			retries = append(retries, e.Err)
+		}
+	}
+	c, _ := asking(t, fake.Reply{Content: "not json"}, answered)
+	if _, err := Ask(c, Question[string]{Prompt: "hi", Events: events}); err != nil {
+		t.Fatal(err)
+	}
+	if len(retries) != 1 || retries[0] == nil {
+		t.Errorf("retries %v", retries)
+	}
+}
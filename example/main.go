@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,7 +13,6 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"xoba.com/llm"
 	"xoba.com/llm/client"
-	"xoba.com/llm/schema"
 )
 
 func main() {
@@ -54,6 +54,8 @@ func conversation(c client.Interface) error {
 		r, err := llm.Ask(c, llm.Question[ConversationResponse]{
 			Prompt:   prompt,
 			Messages: messages,
+			Events:   printEvent,
+			History:  llm.Summarize{Keep: 2},
 		})
 		if err != nil {
 			return err
@@ -73,7 +75,7 @@ func conversation(c client.Interface) error {
 
 func arithmetic(c client.Interface) error {
 	tools := make(map[string]llm.Tool)
-	for _, t := range []llm.Tool{Sum{}, Mult{}, Exp{}} {
+	for _, t := range []llm.Tool{sum, mult, exp} {
 		tools[t.Defintion().Name] = t
 	}
 	const question = "what is 5 * (455342+22342.6)^1.1 * 99?"
@@ -81,6 +83,7 @@ func arithmetic(c client.Interface) error {
 	r, err := llm.Ask(c, llm.Question[ArithmeticResponse]{
 		Prompt: question,
 		Tools:  tools,
+		Events: printEvent,
 		Examples: []llm.Example[ArithmeticResponse]{
 			{
 				Prompt: "what is 7 + 3?",
@@ -104,6 +107,7 @@ func arithmetic(c client.Interface) error {
 	fmt.Printf("conversational: %q\n", r.Answer.ConversationalAnswer)
 	fmt.Printf("formal: %q\n", r.Answer.FormalAnswer.Answer)
 	fmt.Printf("difficulty: %q\n", r.Answer.FormalAnswer.DifficultyRating)
+	fmt.Printf("usage: %d tokens, $%.4f\n", r.Usage.Total.TotalTokens, r.Usage.Cost)
 	for _, m := range r.Messages {
 		buf, err := json.MarshalIndent(m, "", "  ")
 		if err != nil {
@@ -114,76 +118,63 @@ func arithmetic(c client.Interface) error {
 	return nil
 }
 
+// printEvent renders progress on stdout
+func printEvent(e llm.Event) {
+	switch e.Type {
+	case llm.EventTokenDelta, llm.EventToolArgumentsDelta:
+		fmt.Print(e.Text)
+	case llm.EventToolCallStarted:
+		fmt.Printf("\nfunction: %s\nparameters: ", e.Tool)
+	case llm.EventToolResult:
+		fmt.Printf("\nresult = %s\n", e.Text)
+	case llm.EventRetry:
+		fmt.Printf("\nretrying after error: %v\n", e.Err)
+	case llm.EventHistoryTrimmed:
+		fmt.Printf("\n%s\n", e.Text)
+	case llm.EventTranscriptionStarted:
+		fmt.Printf("transcribing %q\n", e.File)
+	case llm.EventFinalAnswer:
+		fmt.Println()
+	}
+}
+
 type ArithmeticResponse struct {
 	Answer           string
-	DifficultyRating string
+	DifficultyRating string `jsonschema:"enum=easy,enum=medium,enum=hard"`
 }
 
 type Sum struct {
 	Addends []float64
 }
 
-func (s Sum) Defintion() openai.FunctionDefinition {
-	return openai.FunctionDefinition{
-		Name:        "sum",
-		Description: "adds numbers",
-		Parameters:  schema.Calculate(s),
-	}
-}
-
-func (s Sum) Compute(p string) (string, error) {
-	if err := json.Unmarshal([]byte(p), &s); err != nil {
-		return "", err
-	}
-	var sum float64
-	for _, x := range s.Addends {
-		sum += x
-	}
-	return fmt.Sprintf("%f", sum), nil
-}
-
 type Mult struct {
 	Multiplicands []float64
 }
 
-func (s Mult) Defintion() openai.FunctionDefinition {
-	return openai.FunctionDefinition{
-		Name:        "mult",
-		Description: "multiplies numbers",
-		Parameters:  schema.Calculate(s),
-	}
-}
-
-func (s Mult) Compute(p string) (string, error) {
-	if err := json.Unmarshal([]byte(p), &s); err != nil {
-		return "", err
-	}
-	product := 1.0
-	for _, x := range s.Multiplicands {
-		product *= x
-	}
-	return fmt.Sprintf("%f", product), nil
-}
-
 type Exp struct {
 	Base  float64
 	Power float64
 }
 
-func (s Exp) Defintion() openai.FunctionDefinition {
-	return openai.FunctionDefinition{
-		Name:        "exp",
-		Description: "exponentiation",
-		Parameters:  schema.Calculate(s),
-	}
-}
-
-func (s Exp) Compute(p string) (string, error) {
-	if err := json.Unmarshal([]byte(p), &s); err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("%f", math.Pow(s.Base, s.Power)), nil
-}
+var (
+	sum = llm.NewTool("sum", "adds numbers", func(_ context.Context, s Sum) (float64, error) {
+		var total float64
+		for _, x := range s.Addends {
+			total += x
+		}
+		return total, nil
+	})
+	mult = llm.NewTool("mult", "multiplies numbers", func(_ context.Context, m Mult) (float64, error) {
+		product := 1.0
+		for _, x := range m.Multiplicands {
+			product *= x
+		}
+		return product, nil
+	})
+	exp = llm.NewTool("exp", "exponentiation", func(_ context.Context, e Exp) (float64, error) {
+		return math.Pow(e.Base, e.Power), nil
+	})
+)
 
 // key via openai env var, or file openai.txt
 func NewDefault() (client.Interface, error) {
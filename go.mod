@@ -5,8 +5,9 @@ go 1.22.0
 require (
 	github.com/google/uuid v1.6.0
 	github.com/invopop/jsonschema v0.12.0
-	github.com/sashabaranov/go-openai v1.20.5
+	github.com/sashabaranov/go-openai v1.32.5
 	github.com/vincent-petithory/dataurl v1.0.0
+	golang.org/x/net v0.35.0
 )
 
 require (
@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/assets"
+	"xoba.com/llm/client"
+)
+
+// HistoryStrategy shortens the past turns of a conversation which, with the
+// current question, would overflow the model's context window
+type HistoryStrategy interface {
+	Trim(ctx context.Context, h History) ([]openai.ChatCompletionMessage, error)
+}
+
+// History is what a HistoryStrategy works with
+type History struct {
+	Client client.Interface
+	Model  client.Model
+	Past   []openai.ChatCompletionMessage // prior turns, to be shortened
+	// Fits reports whether the conversation fits with the given past turns:
+	Fits  func(past []openai.ChatCompletionMessage) bool
+	Usage *Usage // the question's, to which any calls made are added
+}
+
+// DropOldest drops whole turns, oldest first, until the conversation fits
+type DropOldest struct{}
+
+func (DropOldest) Trim(_ context.Context, h History) ([]openai.ChatCompletionMessage, error) {
+	return dropOldest(turns(h.Past), h.Fits), nil
+}
+
+// KeepLast keeps only the last N turns, dropping more if still needed
+type KeepLast struct {
+	N int
+}
+
+func (k KeepLast) Trim(_ context.Context, h History) ([]openai.ChatCompletionMessage, error) {
+	t := turns(h.Past)
+	if len(t) > k.N {
+		t = t[len(t)-max(k.N, 0):]
+	}
+	return dropOldest(t, h.Fits), nil
+}
+
+// Summarize replaces all but the last Keep turns with a summary written by
+// the model, dropping oldest turns if the rest still don't fit
+type Summarize struct {
+	Keep int
+}
+
+func (s Summarize) Trim(ctx context.Context, h History) ([]openai.ChatCompletionMessage, error) {
+	t := turns(h.Past)
+	keep := min(max(s.Keep, 0), len(t))
+	old, recent := t[:len(t)-keep], t[len(t)-keep:]
+	if len(old) == 0 {
+		return dropOldest(recent, h.Fits), nil
+	}
+	// the summary request itself has to fit, so it may not see the oldest turns:
+	transcript := dropOldest(old, func(past []openai.ChatCompletionMessage) bool {
+		return h.Model.CountMessages(summaryRequest(past)) <= h.Model.ContextWindow-h.Model.MaxOutputTokens
+	})
+	if len(transcript) == 0 {
+		return dropOldest(recent, h.Fits), nil
+	}
+	resp, err := h.Client.CompleteContext(ctx, client.CompletionRequest{
+		Model:    h.Model,
+		Format:   client.NoneSpecified,
+		Messages: summaryRequest(transcript),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't summarize history: %w", err)
+	}
+	h.Usage.Add(h.Model, resp.Usage)
+	summary := []openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "here is a summary of the earlier conversation:\n\n" + strings.TrimSpace(resp.Content),
+	}}
+	return append(summary, dropOldest(recent, func(past []openai.ChatCompletionMessage) bool {
+		return h.Fits(append(summary, past...))
+	})...), nil
+}
+
+func summaryRequest(past []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	transcript := new(strings.Builder)
+	for _, m := range past {
+		fmt.Fprintf(transcript, "%s: %s\n", m.Role, m.Content)
+		for _, p := range m.MultiContent {
+			if p.Type == openai.ChatMessagePartTypeText {
+				fmt.Fprintf(transcript, "%s: %s\n", m.Role, p.Text)
+			}
+		}
+		for _, c := range m.ToolCalls {
+			fmt.Fprintf(transcript, "%s: called %s(%s)\n", m.Role, c.Function.Name, c.Function.Arguments)
+		}
+	}
+	return []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: "summarize the following conversation concisely in plain text, keeping every fact, decision and open question needed to continue it.",
+		},
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: transcript.String(),
+		},
+	}
+}
+
+// turns splits messages where a new exchange starts, so a tool call is never
+// separated from its results
+func turns(messages []openai.ChatCompletionMessage) [][]openai.ChatCompletionMessage {
+	var out [][]openai.ChatCompletionMessage
+	for i, m := range messages {
+		if i == 0 || (reply(messages[i-1]) && !reply(m)) {
+			out = append(out, nil)
+		}
+		out[len(out)-1] = append(out[len(out)-1], m)
+	}
+	return out
+}
+
+// reply is whether the message is part of the assistant's side of a turn
+func reply(m openai.ChatCompletionMessage) bool {
+	return m.Role == openai.ChatMessageRoleAssistant || m.Role == openai.ChatMessageRoleTool
+}
+
+func dropOldest(turns [][]openai.ChatCompletionMessage, fits func([]openai.ChatCompletionMessage) bool) []openai.ChatCompletionMessage {
+	for i := range turns {
+		past := flatten(turns[i:])
+		if fits(past) {
+			return past
+		}
+	}
+	return nil
+}
+
+func flatten(turns [][]openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	var out []openai.ChatCompletionMessage
+	for _, t := range turns {
+		out = append(out, t...)
+	}
+	return out
+}
+
+// schemaPrompt introduces the answer schema, when not enforced by the api
+const schemaPrompt = "the schema of your json answer must match: "
+
+// pinned messages are the framework's own instructions, never trimmed
+func pinned(m openai.ChatCompletionMessage) bool {
+	switch {
+	case m.Role == openai.ChatMessageRoleSystem && (m.Content == assets.Prompt1 || m.Content == assets.Prompt2):
+		return true
+	case m.Role == openai.ChatMessageRoleUser && strings.HasPrefix(m.Content, schemaPrompt):
+		return true
+	}
+	return false
+}
+
+// fitHistory applies the strategy to the messages before current, if
+// they'd overflow the model's context window, keeping pinned messages first.
+// it reports whether the messages changed, adding any calls made to usage.
+func fitHistory(ctx context.Context, strategy HistoryStrategy, c client.Interface, req client.CompletionRequest, current int, usage *Usage) ([]openai.ChatCompletionMessage, bool, error) {
+	m := req.Model
+	if m.ContextWindow == 0 {
+		return req.Messages, false, nil // unknown, so nothing to fit
+	}
+	budget := m.ContextWindow - max(req.MaxTokens, m.MaxOutputTokens)
+	fixed := req
+	fixed.Messages = nil
+	overhead := m.CountRequest(fixed)
+	var pins, past []openai.ChatCompletionMessage
+	for _, x := range req.Messages[:current] {
+		if pinned(x) {
+			pins = append(pins, x)
+		} else {
+			past = append(past, x)
+		}
+	}
+	rest := req.Messages[current:]
+	assemble := func(past []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+		return append(append(append([]openai.ChatCompletionMessage(nil), pins...), past...), rest...)
+	}
+	fits := func(past []openai.ChatCompletionMessage) bool {
+		return overhead+m.CountMessages(assemble(past)) <= budget
+	}
+	if len(past) == 0 || fits(past) {
+		return req.Messages, false, nil
+	}
+	if strategy == nil {
+		strategy = DropOldest{}
+	}
+	trimmed, err := strategy.Trim(ctx, History{Client: c, Model: m, Past: past, Fits: fits, Usage: usage})
+	if err != nil {
+		return nil, false, err
+	}
+	return assemble(trimmed), true, nil
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/client"
+	"xoba.com/llm/client/fake"
+)
+
+func TestSummarizeUsage(t *testing.T) {
+	s := fake.OpenAI(fake.Reply{Content: "they talked about the weather"})
+	defer s.Close()
+	c, err := client.NewFromConfig(client.Config{Provider: client.OpenAIProvider, Key: "test", BaseURL: s.BaseURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := client.Model{Name: "small", Provider: client.OpenAIProvider, ContextWindow: 300, MaxOutputTokens: 50, Pricing: client.Pricing{Prompt: 1, Completion: 2}}
+	chatter := strings.Repeat("the weather is fine today, or so they say ", 3)
+	var messages []openai.ChatCompletionMessage
+	for range 10 {
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: chatter},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: chatter})
+	}
+	current := len(messages)
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "and tomorrow?"})
+
+	var usage Usage
+	req := client.CompletionRequest{Model: model, Format: client.NoneSpecified, Messages: messages}
+	trimmed, changed, err := fitHistory(context.Background(), Summarize{Keep: 1}, c, req, current, &usage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !strings.Contains(trimmed[0].Content, "they talked about the weather") {
+		t.Fatalf("not summarized: %+v", trimmed)
+	}
+	// the summary is billed to the question:
+	if len(usage.Calls) != 1 || usage.Calls[0].Model != "small" || usage.Total.TotalTokens == 0 || usage.Cost == 0 {
+		t.Errorf("usage %+v", usage)
+	}
+	if usage.ByModel["small"] != usage.Total {
+		t.Errorf("by model %+v, total %+v", usage.ByModel, usage.Total)
+	}
+}
@@ -0,0 +1,469 @@
+// package htmltext converts html to markdown text, keeping the content of a
+// page (headings, lists, tables, links) and dropping scripts, styles and
+// navigation
+package htmltext
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"xoba.com/llm/markdown"
+)
+
+// Markdown converts an html document. only its main content is kept, if
+// it's marked as such with <main> or a lone <article>.
+func Markdown(data []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	root := mainContent(doc)
+	w := new(writer)
+	if find(root, func(n *html.Node) bool { return n.DataAtom == atom.H1 }) == nil {
+		// the title stands in for a missing top heading:
+		if t := find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Title }); t != nil {
+			if title := collapse(textContent(t)); len(strings.TrimSpace(title)) > 0 {
+				w.raw("# " + strings.TrimSpace(title))
+				w.block()
+			}
+		}
+	}
+	children(w, root)
+	return tidy(w.String()), nil
+}
+
+// mainContent returns <main>, a lone <article>, or else <body>
+func mainContent(doc *html.Node) *html.Node {
+	if m := find(doc, func(n *html.Node) bool {
+		return n.DataAtom == atom.Main || attr(n, "role") == "main"
+	}); m != nil {
+		return m
+	}
+	var articles []*html.Node
+	walk(doc, func(n *html.Node) bool {
+		if n.DataAtom == atom.Article {
+			articles = append(articles, n)
+			return false
+		}
+		return true
+	})
+	if len(articles) == 1 {
+		return articles[0]
+	}
+	if b := find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Body }); b != nil {
+		return b
+	}
+	return doc
+}
+
+// walk visits nodes depth first, descending while visit returns true
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || visit(c) {
+			walk(c, visit)
+		}
+	}
+}
+
+// find returns the first element matching, depth first
+func find(n *html.Node, match func(*html.Node) bool) *html.Node {
+	var out *html.Node
+	walk(n, func(c *html.Node) bool {
+		if out == nil && match(c) {
+			out = c
+		}
+		return out == nil
+	})
+	return out
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := attrOK(n, key)
+	return v
+}
+
+// skipped elements hold no content, or only boilerplate. forms aren't
+// skipped, only their controls, as some sites wrap whole pages in one.
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Head: true, atom.Svg: true, atom.Math: true, atom.Iframe: true, atom.Object: true,
+	atom.Canvas: true, atom.Video: true, atom.Audio: true, atom.Map: true,
+	atom.Nav: true, atom.Aside: true, atom.Button: true, atom.Datalist: true,
+	atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Dialog: true, atom.Menu: true,
+}
+
+// boilerplate roles, as used by sites without semantic elements
+var boilerplate = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "menu": true, "menubar": true, "dialog": true, "alert": true,
+}
+
+var hiddenStyle = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden`)
+
+func hidden(n *html.Node) bool {
+	_, isHidden := attrOK(n, "hidden")
+	return isHidden || attr(n, "aria-hidden") == "true" || boilerplate[attr(n, "role")] || hiddenStyle.MatchString(attr(n, "style"))
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// withinContent is whether a header or footer belongs to an article or
+// section, rather than to the site
+func withinContent(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		switch p.DataAtom {
+		case atom.Article, atom.Section, atom.Main:
+			return true
+		}
+	}
+	return false
+}
+
+func children(w *writer, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		node(w, c)
+	}
+}
+
+// render converts a node's children on their own, trimmed
+func render(n *html.Node) string {
+	w := new(writer)
+	children(w, n)
+	return tidy(w.String())
+}
+
+func node(w *writer, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		children(w, n)
+		return
+	}
+	if skipped[n.DataAtom] || hidden(n) {
+		return
+	}
+	switch a := n.DataAtom; a {
+	case atom.Header, atom.Footer:
+		if !withinContent(n) {
+			return
+		}
+		block(w, n)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		if text := oneLine(render(n)); len(text) > 0 {
+			w.block()
+			w.raw(strings.Repeat("#", int(a.String()[1]-'0')) + " " + text)
+			w.block()
+		}
+	case atom.Br:
+		w.newline()
+	case atom.Hr:
+		w.block()
+		w.raw("---")
+		w.block()
+	case atom.Pre:
+		code := strings.TrimRight(textContent(n), "\n")
+		if len(strings.TrimSpace(code)) > 0 {
+			w.block()
+			w.raw("```\n" + code + "\n```")
+			w.block()
+		}
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		inline(w, n, "`")
+	case atom.Strong, atom.B:
+		inline(w, n, "**")
+	case atom.Em, atom.I:
+		inline(w, n, "*")
+	case atom.A:
+		link(w, n)
+	case atom.Img:
+		if alt := oneLine(attr(n, "alt")); len(alt) > 0 {
+			if src := attr(n, "src"); len(src) > 0 && !strings.HasPrefix(src, "data:") {
+				w.raw(fmt.Sprintf("![%s](%s)", alt, src))
+			} else {
+				w.raw(fmt.Sprintf("[image: %s]", alt))
+			}
+		}
+	case atom.Ul, atom.Ol:
+		list(w, n)
+	case atom.Li:
+		// outside a list:
+		w.block()
+		w.raw(indent("- ", render(n)))
+		w.block()
+	case atom.Blockquote:
+		if text := render(n); len(text) > 0 {
+			w.block()
+			lines := strings.Split(text, "\n")
+			for i, l := range lines {
+				lines[i] = strings.TrimRight("> "+l, " ")
+			}
+			w.raw(strings.Join(lines, "\n"))
+			w.block()
+		}
+	case atom.Table:
+		table(w, n)
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Figure, atom.Figcaption,
+		atom.Address, atom.Dl, atom.Dt, atom.Dd, atom.Details, atom.Summary, atom.Center,
+		atom.Caption, atom.Form, atom.Fieldset, atom.Legend, atom.Body, atom.Html:
+		block(w, n)
+	default:
+		children(w, n)
+	}
+}
+
+func block(w *writer, n *html.Node) {
+	w.block()
+	children(w, n)
+	w.block()
+}
+
+// inline marks up inline content, keeping spaces outside the marks
+func inline(w *writer, n *html.Node, mark string) {
+	raw := collapse(textContent(n))
+	text := oneLine(raw)
+	if mark != "`" {
+		text = oneLine(render(n))
+	}
+	if len(text) == 0 {
+		w.text(raw)
+		return
+	}
+	spaced(w, raw, mark+text+mark)
+}
+
+// spaced writes markup in place of raw text, keeping its surrounding spaces
+func spaced(w *writer, raw, markup string) {
+	if strings.HasPrefix(raw, " ") {
+		w.text(" ")
+	}
+	w.raw(markup)
+	if strings.HasSuffix(raw, " ") {
+		w.text(" ")
+	}
+}
+
+func link(w *writer, n *html.Node) {
+	text := oneLine(render(n))
+	if len(text) == 0 {
+		return
+	}
+	href := strings.TrimSpace(attr(n, "href"))
+	switch lower := strings.ToLower(href); {
+	case len(href) == 0, strings.HasPrefix(href, "#"), strings.HasPrefix(lower, "javascript:"):
+	default:
+		text = "[" + text + "](" + strings.ReplaceAll(href, " ", "%20") + ")"
+	}
+	spaced(w, collapse(textContent(n)), text)
+}
+
+func list(w *writer, n *html.Node) {
+	number := 1
+	if s, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = s
+	}
+	var items []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		var text string
+		switch {
+		case c.Type == html.ElementNode && c.DataAtom == atom.Li:
+			if skipped[c.DataAtom] || hidden(c) {
+				continue
+			}
+			text = render(c)
+		case c.Type == html.ElementNode && (c.DataAtom == atom.Ul || c.DataAtom == atom.Ol):
+			// a list directly within a list, belonging to the previous item:
+			sub := new(writer)
+			list(sub, c)
+			if nested := tidy(sub.String()); len(nested) > 0 && len(items) > 0 {
+				items[len(items)-1] += "\n" + indent("  ", nested)
+			}
+			continue
+		default:
+			continue
+		}
+		if len(text) == 0 {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		items = append(items, indent(marker, text))
+	}
+	if len(items) > 0 {
+		w.block()
+		w.raw(strings.Join(items, "\n"))
+		w.block()
+	}
+}
+
+// indent prefixes the first line with the marker, and the others with as many spaces
+func indent(marker, text string) string {
+	lines := strings.Split(text, "\n")
+	pad := strings.Repeat(" ", len(marker))
+	for i, l := range lines {
+		switch {
+		case i == 0:
+			lines[i] = marker + l
+		case len(l) > 0:
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func table(w *writer, n *html.Node) {
+	var rows [][]string
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || hidden(c) {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom != atom.Td && cell.DataAtom != atom.Th {
+						continue
+					}
+					row = append(row, oneLine(render(cell)))
+					if span, err := strconv.Atoi(attr(cell, "colspan")); err == nil {
+						for range min(span, 64) - 1 {
+							row = append(row, "")
+						}
+					}
+				}
+				rows = append(rows, row)
+			case atom.Table:
+				// nested tables are flattened into their cells
+			default:
+				visit(c)
+			}
+		}
+	}
+	visit(n)
+	caption := find(n, func(c *html.Node) bool { return c.DataAtom == atom.Caption })
+	if t := markdown.Table(rows); len(t) > 0 {
+		w.block()
+		if caption != nil {
+			if text := oneLine(render(caption)); len(text) > 0 {
+				w.raw(text + "\n\n")
+			}
+		}
+		w.raw(strings.TrimSuffix(t, "\n"))
+		w.block()
+	}
+}
+
+// textContent is all the text within a node, as is
+func textContent(n *html.Node) string {
+	var out strings.Builder
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				out.WriteString(c.Data)
+			case c.Type == html.ElementNode && c.DataAtom == atom.Br:
+				out.WriteString("\n")
+			case c.Type == html.ElementNode && (c.DataAtom == atom.Script || c.DataAtom == atom.Style):
+			default:
+				visit(c)
+			}
+		}
+	}
+	visit(n)
+	return out.String()
+}
+
+// collapse replaces runs of whitespace with single spaces
+func collapse(s string) string {
+	var out strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			out.WriteByte(' ')
+			space = false
+		}
+		out.WriteRune(r)
+	}
+	if space {
+		out.WriteByte(' ')
+	}
+	return out.String()
+}
+
+func oneLine(s string) string {
+	return strings.TrimSpace(collapse(s))
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// tidy trims trailing spaces from lines, and runs of blank lines
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// writer accumulates markdown, collapsing the whitespace of text
+type writer struct {
+	strings.Builder
+}
+
+func (w *writer) atLineStart() bool {
+	s := w.String()
+	return len(s) == 0 || strings.HasSuffix(s, "\n")
+}
+
+func (w *writer) text(s string) {
+	s = collapse(s)
+	if w.atLineStart() || strings.HasSuffix(w.String(), " ") {
+		s = strings.TrimLeft(s, " ")
+	}
+	w.WriteString(s)
+}
+
+func (w *writer) raw(s string) {
+	w.WriteString(s)
+}
+
+func (w *writer) newline() {
+	w.WriteString("\n")
+}
+
+// block ends any paragraph in progress
+func (w *writer) block() {
+	s := w.String()
+	switch {
+	case len(s) == 0, strings.HasSuffix(s, "\n\n"):
+	case strings.HasSuffix(s, "\n"):
+		w.WriteString("\n")
+	default:
+		w.WriteString("\n\n")
+	}
+}
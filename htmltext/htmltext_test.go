@@ -0,0 +1,49 @@
+package htmltext
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	for _, c := range []struct {
+		name, html, want string
+	}{
+		{"headings",
+			`<h1>Title</h1><p>intro</p><h2>Part  one</h2><h3></h3><p>body</p>`,
+			"# Title\n\nintro\n\n## Part one\n\nbody"},
+		{"title for a missing heading",
+			`<html><head><title> The page </title></head><body><p>text</p></body></html>`,
+			"# The page\n\ntext"},
+		{"lists",
+			`<ul><li>one</li><li>two<ul><li>nested</li></ul></li><li></li></ul><ol start="3"><li>three</li><li>four</li></ol>`,
+			"- one\n- two\n\n  - nested\n\n3. three\n4. four"},
+		{"tables",
+			`<table><caption>Sizes</caption><tr><th>name</th><th>size</th></tr><tr><td>a|b</td><td>1</td></tr><tr><td colspan="2">wide</td></tr></table>`,
+			"Sizes\n\n| name | size |\n| --- | --- |\n| a\\|b | 1 |\n| wide |  |"},
+		{"links",
+			`<p>see <a href="https://example.com/a b">the docs</a>, <a href="#top">top</a> and <a href="javascript:go()">go</a>.</p>`,
+			"see [the docs](https://example.com/a%20b), top and go."},
+		{"inline",
+			`<p><b>bold</b> and <em>it</em> and <code>x  y</code></p><pre>a
+  b</pre>`,
+			"**bold** and *it* and `x y`\n\n```\na\n  b\n```"},
+		{"skipped elements",
+			`<nav>menu</nav><script>var x</script><style>p{}</style><p>kept</p><div hidden>gone</div><div style="display: none">gone</div><div role="navigation">gone</div><aside>aside</aside><footer>site</footer>`,
+			"kept"},
+		{"forms keep their content",
+			`<body><form action="/page.aspx"><input type="hidden" value="state"><h1>Report</h1><p>the findings</p><select><option>pick</option></select><textarea>draft</textarea><button>Go</button></form></body>`,
+			"# Report\n\nthe findings"},
+		{"main content",
+			`<header>site header</header><main><p>the article</p></main><footer>site footer</footer>`,
+			"the article"},
+		{"entities",
+			`<p>fish &amp; chips &lt;3 &eacute;t&eacute; &#8364;5&nbsp;each &quot;ok&quot;</p>`,
+			"fish & chips <3 été €5 each \"ok\""},
+	} {
+		got, err := Markdown([]byte(c.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -3,19 +3,22 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"os/exec"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/invopop/jsonschema"
 	"github.com/sashabaranov/go-openai"
 	"github.com/vincent-petithory/dataurl"
 	"xoba.com/llm/assets"
+	"xoba.com/llm/cache"
 	"xoba.com/llm/client"
+	"xoba.com/llm/pdf"
 	"xoba.com/llm/schema"
 )
 
@@ -27,6 +30,68 @@ type Question[ANSWER any] struct {
 	Examples []Example[ANSWER]              // examples of what the answer may look like (additional each round)
 	Tools    map[string]Tool                // tools at the assistant's disposal
 	Messages []openai.ChatCompletionMessage // state of prior conversation
+	Model    string                         // name of a registered model, otherwise selected by capabilities
+	Events   func(Event)                    // if non-nil, called with progress as it happens
+	// maximum number of tool calls computed concurrently, 0 means no limit:
+	ToolConcurrency int
+	ToolErrors      ToolErrorPolicy
+	MaxToolErrors   int // per question, under ReportToolErrors; 0 means a default of 5
+	// shortens prior turns which would overflow the context window; if nil, DropOldest:
+	History HistoryStrategy
+	// if non-nil, only the passages of text files most relevant to the prompt are sent:
+	Retrieval *Retrieval
+	// extracts the text of pdf files; if nil, pdf.Extract, or pdf.Pdftotext for poppler's binary:
+	PDF func(ctx context.Context, data []byte) ([]pdf.Page, error)
+	// identifies the output of PDF in Cache keys, e.g. "pdftotext 24.02", so
+	// extractors never share cached text; needed to cache a custom PDF's:
+	PDFVersion string
+	// converters of Files by content type, overriding those registered with RegisterConverter:
+	Converters map[string]Converter
+	Archives   ArchiveLimits // on expanding zip and tar files
+	// if non-nil, remembers the text of pdf files, so files attached again
+	// aren't extracted again. transcripts are cached by client.Config.Cache
+	// instead, as the client transcribes for any caller, while pdf text is
+	// extracted per question; one store may serve both.
+	Cache cache.Cache
+}
+
+// ToolErrorPolicy is what Ask does when a tool call fails
+type ToolErrorPolicy int
+
+const (
+	AbortOnToolError ToolErrorPolicy = iota // return the error from Ask
+	ReportToolErrors                        // tell the model, so it can correct itself
+)
+
+func (q Question[ANSWER]) maxToolErrors() int {
+	if q.MaxToolErrors > 0 {
+		return q.MaxToolErrors
+	}
+	return 5
+}
+
+// ToolError is a failed tool call
+type ToolError struct {
+	Tool      string
+	CallID    string
+	Arguments string
+	Err       error
+}
+
+func (e ToolError) Error() string {
+	return fmt.Sprintf("tool %q: %v", e.Tool, e.Err)
+}
+
+func (e ToolError) Unwrap() error {
+	return e.Err
+}
+
+func asErrors(list []ToolError) []error {
+	var out []error
+	for _, e := range list {
+		out = append(out, e)
+	}
+	return out
 }
 
 type Example[ANSWER any] struct {
@@ -38,7 +103,12 @@ type Example[ANSWER any] struct {
 type File struct {
 	Name        string
 	Content     []byte
-	ContentType string
+	ContentType string // if empty, generic or contradicted by the content, it's detected
+	// for audio and video, whether to mark the transcript with the times of
+	// its segments, so answers can refer to them:
+	Timestamps bool
+	// for audio and video, e.g. to translate meetings into english:
+	Transcription client.TranscriptionOptions
 }
 
 type Tool interface {
@@ -46,6 +116,18 @@ type Tool interface {
 	Compute(parameters string) (string, error)
 }
 
+// ContextTool is a Tool whose computation can be cancelled
+type ContextTool interface {
+	Tool
+	ComputeContext(ctx context.Context, parameters string) (string, error)
+}
+
+var (
+	ErrInterrupted      = errors.New("ask interrupted") // the tool/retry loop was interrupted by its context
+	ErrUnknownTool      = errors.New("unknown tool")
+	ErrInvalidArguments = errors.New("invalid json arguments")
+)
+
 // Answer is the response to asking a Question
 type Answer[ANSWER any] struct {
 	ConversationalAnswer string // free-form, high-level answer to the question
@@ -53,8 +135,10 @@ type Answer[ANSWER any] struct {
 }
 
 type Response[ANSWER any] struct {
-	Answer   *Answer[ANSWER]
-	Messages []openai.ChatCompletionMessage
+	Answer     *Answer[ANSWER]
+	Messages   []openai.ChatCompletionMessage
+	Usage      Usage
+	ToolErrors []ToolError // tool failures reported to the model, per ReportToolErrors
 }
 
 func (r Answer[T]) String() string {
@@ -63,7 +147,36 @@ func (r Answer[T]) String() string {
 }
 
 func Ask[ANSWER any](c client.Interface, q Question[ANSWER]) (*Response[ANSWER], error) {
+	return AskContext(context.Background(), c, q)
+}
+
+// AskContext is like Ask, but every api call and tool computation is bound to ctx
+func AskContext[ANSWER any](ctx context.Context, c client.Interface, q Question[ANSWER]) (*Response[ANSWER], error) {
+	events := emitter(q.Events)
+	conversion := &Conversion{
+		Client:     c,
+		PDF:        q.PDF,
+		converters: q.Converters,
+		events:     events,
+		expansion:  &expansion{limits: q.Archives.withDefaults()},
+	}
+	extractor := q.PDFVersion
+	if conversion.PDF == nil {
+		conversion.PDF = pdf.Extract
+		extractor = "pdf.Extract " + pdf.Version
+	}
+	if q.Cache != nil {
+		if len(extractor) == 0 {
+			return nil, errors.New("a custom PDF extractor needs a PDFVersion to be cached")
+		}
+		conversion.PDF = cachedPDF(q.Cache, extractor, conversion.PDF)
+	}
+	// fail before any api call if some file can't be converted:
+	if err := conversion.check(q.Files); err != nil {
+		return nil, err
+	}
 	firstQuestion := len(q.Messages) == 0
+	current := len(q.Messages) // where this question's messages start
 	add := func(m openai.ChatCompletionMessage) {
 		q.Messages = append(q.Messages, m)
 	}
@@ -77,88 +190,86 @@ func Ask[ANSWER any](c client.Interface, q Question[ANSWER]) (*Response[ANSWER],
 			Content: assets.Prompt2,
 		})
 	}
-	whichModel := client.GPT4Turbo
-	responseFormat := client.JSONResponse
-	var maxTokens int
+	needs := client.Requirements{
+		Provider: c.Provider(),
+		Tools:    len(q.Tools) > 0,
+	}
 	if len(q.Files) > 0 {
 		add(openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleSystem,
 			Content: fmt.Sprintf(`there are going to be %d files in the following request, each of which you will use as background material for assisting the user.`, len(q.Files)),
 		})
 	}
+	var docs []document
+	// paste adds a file's text, or holds it for retrieval:
+	paste := func(p Part) {
+		if q.Retrieval != nil {
+			docs = append(docs, document{Name: p.Name, Text: p.Text})
+			return
+		}
+		add(openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: p.Label + ":\n\n" + p.Text,
+		})
+	}
 	for _, d := range q.Files {
-		switch d.ContentType {
-		case "audio/mp3", "audio/mp4", "audio/mpeg", "audio/wav", "audio/x-wav", "audio/webm", "video/mp4", "video/mpeg", "video/webm":
-			txt, err := c.TranscribeAV(client.TranscriptionRequest{
-				File: client.AVFile{ContentType: d.ContentType, Content: d.Content},
-			})
-			if err != nil {
-				return nil, err
+		parts, err := conversion.Convert(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range parts {
+			if p.Image == nil {
+				paste(p)
+				continue
 			}
-			add(openai.ChatCompletionMessage{
-				Role: openai.ChatMessageRoleSystem,
-				Content: fmt.Sprintf(
-					"here is the transcription of a %s file named %q:\n\n%s",
-					d.ContentType, d.Name,
-					txt,
-				),
-			})
-		case "application/pdf":
-			txt, err := pdfToText(d.Content)
-			if err != nil {
-				return nil, err
+			needs.Images = true
+			content := []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: p.Label}}
+			if len(p.Text) > 0 {
+				content = append(content, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: p.Text})
 			}
 			add(openai.ChatCompletionMessage{
 				Role: openai.ChatMessageRoleSystem,
-				Content: fmt.Sprintf(
-					"here is the text rendering of an %s file named %q:\n\n%s",
-					d.ContentType, d.Name,
-					string(txt),
-				),
-			})
-		case "application/json",
-			"text/plain", "text/html", "text/markdown", "text/csv", "text/xml", "text/rtf",
-			"text/tab-separated-values", "text/richtext",
-			"text/yaml", "text/x-yaml", "text/x-markdown", "text/x-rst", "text/x-org":
-			add(openai.ChatCompletionMessage{
-				Role: openai.ChatMessageRoleSystem,
-				Content: fmt.Sprintf(
-					"here is a %s file named %q:\n\n%s",
-					d.ContentType, d.Name,
-					string(d.Content),
-				),
-			})
-		case "image/png", "image/jpeg", "image/webp", "image/gif":
-			whichModel = client.GPT4Vision
-			responseFormat = client.NoneSpecified // vision has no format at all
-			maxTokens = 4096                      // specify, since vision defaults to few output tokens
-			add(openai.ChatCompletionMessage{
-				Role: openai.ChatMessageRoleSystem,
-				MultiContent: []openai.ChatMessagePart{
-					{
-						Type: openai.ChatMessagePartTypeText,
-						Text: fmt.Sprintf(
-							"here is an %s file named %q",
-							d.ContentType, d.Name,
-						),
+				MultiContent: append(content, openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{
+						URL: dataurl.New(p.Image.Content, p.Image.ContentType).String(),
 					},
-					{
-						Type: openai.ChatMessagePartTypeImageURL,
-						ImageURL: &openai.ChatMessageImageURL{
-							URL: dataurl.New(d.Content, d.ContentType).String(),
-						},
-					},
-				},
+				}),
 			})
-		default:
-			return nil, fmt.Errorf("unsupported content type: %q", d.ContentType)
+		}
+	}
+	if len(docs) > 0 {
+		m, err := q.Retrieval.retrieve(ctx, c, q.Prompt, docs)
+		if err != nil {
+			return nil, err
+		}
+		add(m)
+	}
+	model, err := selectModel(q.Model, needs)
+	if err != nil {
+		return nil, err
+	}
+	responseFormat := client.NoneSpecified
+	if model.JSONMode {
+		responseFormat = client.JSONResponse
+	}
+	var maxTokens int
+	if needs.Images {
+		maxTokens = model.MaxOutputTokens // specify, since vision may default to few output tokens
+	}
+	var answerSchema json.Marshaler
+	if model.Structured {
+		// fall back to the prompted schema if strict mode can't express it:
+		if s, err := strictSchema[ANSWER](); err == nil {
+			responseFormat = client.JSONSchemaResponse
+			answerSchema = s
 		}
 	}
 	add(openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleUser,
 		Content: q.Prompt,
 	})
-	if firstQuestion {
+	if firstQuestion && answerSchema == nil {
 		responseSchema := schema.Calculate(&Answer[ANSWER]{})
 		schema, err := json.MarshalIndent(responseSchema, "", "  ")
 		if err != nil {
@@ -166,7 +277,7 @@ func Ask[ANSWER any](c client.Interface, q Question[ANSWER]) (*Response[ANSWER],
 		}
 		add(openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleUser,
-			Content: fmt.Sprintf(`the schema of your json answer must match: %s`, string(schema)),
+			Content: schemaPrompt + string(schema),
 		})
 	}
 	if len(q.Examples) > 0 {
@@ -189,9 +300,10 @@ func Ask[ANSWER any](c client.Interface, q Question[ANSWER]) (*Response[ANSWER],
 		})
 	}
 	var errs []error
+	var toolErrors []ToolError
+	var usage Usage
 	var tools []openai.Tool
-	switch whichModel {
-	case client.GPT4Turbo:
+	if model.Tools {
 		for name, t := range q.Tools {
 			def := t.Defintion()
 			if name != def.Name {
@@ -205,56 +317,95 @@ func Ask[ANSWER any](c client.Interface, q Question[ANSWER]) (*Response[ANSWER],
 		sort.Slice(tools, func(i, j int) bool {
 			return tools[i].Function.Name < tools[j].Function.Name
 		})
-	case client.GPT4Vision:
-		// tools not supported by GPTV!
 	}
 LOOP:
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, interrupted(err)
+		}
 		if len(errs) > 4 {
 			return nil, fmt.Errorf("too many tries: %v", errs)
 		}
-		resp, err := c.Complete(client.CompletionRequest{
-			Model:     whichModel,
+		req := client.CompletionRequest{
+			Model:     model,
 			Format:    responseFormat,
 			MaxTokens: maxTokens,
-			Stream:    os.Stdout,
 			Messages:  q.Messages,
 			Tools:     tools,
-		})
+			Schema:    answerSchema,
+		}
+		messages, trimmed, err := fitHistory(ctx, q.History, c, req, current, &usage)
 		if err != nil {
 			return nil, err
 		}
+		if trimmed {
+			events.emit(Event{
+				Type: EventHistoryTrimmed,
+				Text: fmt.Sprintf("history shortened from %d to %d messages", len(q.Messages), len(messages)),
+			})
+			current = len(messages) - (len(q.Messages) - current)
+			q.Messages = messages
+			req.Messages = messages
+		}
+		if events != nil {
+			req.Stream = events
+			req.ToolDeltas = events.toolDelta
+		}
+		resp, err := c.CompleteContext(ctx, req)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, interrupted(ctxErr)
+		} else if err != nil {
+			return nil, err
+		}
+		usage.Add(model, resp.Usage)
 		switch resp.FinishReason {
 		case "tool_calls":
+			// one assistant message holds every call of the round:
+			assistant := openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: strings.TrimSpace(resp.Content),
+			}
+			abort := q.ToolErrors == AbortOnToolError
 			for _, call := range resp.FunctionCalls {
-				tool, ok := q.Tools[call.Name]
-				if !ok {
-					return nil, fmt.Errorf("unknown tool: %q", call.Name)
+				if _, ok := q.Tools[call.Name]; !ok && abort {
+					return nil, fmt.Errorf("%w: %q", ErrUnknownTool, call.Name)
 				}
-				result, err := tool.Compute(call.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				fmt.Printf("result = %s\n", result)
-				add(openai.ChatCompletionMessage{
-					Role: openai.ChatMessageRoleAssistant,
-					ToolCalls: []openai.ToolCall{
-						{
-							ID:   call.ID,
-							Type: openai.ToolTypeFunction,
-							Function: openai.FunctionCall{
-								Name:      call.Name,
-								Arguments: call.Arguments,
-							},
-						},
+				assistant.ToolCalls = append(assistant.ToolCalls, openai.ToolCall{
+					ID:   call.ID,
+					Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{
+						Name:      call.Name,
+						Arguments: call.Arguments,
 					},
 				})
+			}
+			add(assistant)
+			results, callErrs := computeAll(ctx, q.Tools, resp.FunctionCalls, q.ToolConcurrency, abort, events)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, interrupted(ctxErr)
+			} else if err := rootCause(callErrs); err != nil && abort {
+				return nil, err
+			}
+			for i, call := range resp.FunctionCalls {
+				content := results[i]
+				if err := callErrs[i]; err != nil {
+					toolErrors = append(toolErrors, ToolError{
+						Tool:      call.Name,
+						CallID:    call.ID,
+						Arguments: call.Arguments,
+						Err:       err,
+					})
+					content = fmt.Sprintf("error: %v", err)
+				}
 				add(openai.ChatCompletionMessage{
 					Role:       openai.ChatMessageRoleTool,
-					Content:    result,
+					Content:    content,
 					ToolCallID: call.ID,
 				})
 			}
+			if len(toolErrors) > q.maxToolErrors() {
+				return nil, fmt.Errorf("too many tool errors: %w", errors.Join(asErrors(toolErrors)...))
+			}
 			continue LOOP
 
 		case "stop":
@@ -270,7 +421,7 @@ LOOP:
 			d.DisallowUnknownFields()
 			var parsedResponse Answer[ANSWER]
 			if err := d.Decode(&parsedResponse); err != nil {
-				log.Printf("error decoding, going to potentially retry: %v", err)
+				events.emit(Event{Type: EventRetry, Err: err})
 				errs = append(errs, err)
 				add(openai.ChatCompletionMessage{
 					Role:    openai.ChatMessageRoleUser,
@@ -278,9 +429,21 @@ LOOP:
 				})
 				continue LOOP
 			}
+			if err := validate(resp.Content, &parsedResponse); err != nil {
+				events.emit(Event{Type: EventRetry, Err: err})
+				errs = append(errs, err)
+				add(openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleUser,
+					Content: fmt.Sprintf("oops, your answer is invalid: %v. could you please re-do it, correcting those problems?", err),
+				})
+				continue LOOP
+			}
+			events.emit(Event{Type: EventFinalAnswer, Answer: &parsedResponse})
 			return &Response[ANSWER]{
-				Answer:   &parsedResponse,
-				Messages: q.Messages,
+				Answer:     &parsedResponse,
+				Messages:   q.Messages,
+				Usage:      usage,
+				ToolErrors: toolErrors,
 			}, nil
 		default:
 			return nil, fmt.Errorf("unhandled finish reason: %q", resp.FinishReason)
@@ -288,10 +451,141 @@ LOOP:
 	}
 }
 
-func pdfToText(pdf []byte) ([]byte, error) {
-	cmd := exec.Command("pdftotext", "-", "-")
-	cmd.Stdin = bytes.NewReader(pdf)
-	return cmd.Output()
+// selectModel looks up the named model, or selects one meeting the needs
+func selectModel(name string, needs client.Requirements) (client.Model, error) {
+	if len(name) == 0 {
+		m, err := client.Select(needs)
+		if err != nil && !registered(needs.Provider) {
+			// nothing known about the provider's models, so use its default and hope for the best:
+			return client.Model{Provider: needs.Provider, Tools: needs.Tools, JSONMode: true, Images: needs.Images}, nil
+		}
+		if without := needs; err != nil && needs.Tools {
+			// only tools are missing, which is worth saying:
+			without.Tools = false
+			if _, e := client.Select(without); e == nil {
+				return client.Model{}, fmt.Errorf("no registered %s model can call tools, as %+v needs: register one with client.Register, or name one in Question.Model", needs.Provider, needs)
+			}
+		}
+		return m, err
+	}
+	m, ok := client.Lookup(name)
+	if !ok {
+		return client.Model{}, fmt.Errorf("unknown model: %q", name)
+	}
+	if !m.Satisfies(needs) {
+		return client.Model{}, fmt.Errorf("model %q does not satisfy %+v", name, needs)
+	}
+	return m, nil
+}
+
+// answerSchema is the schema of answers, whose formal part is optional per the prompt
+func answerSchema[ANSWER any]() *jsonschema.Schema {
+	s := schema.Calculate(&Answer[ANSWER]{})
+	s.Required = slices.DeleteFunc(s.Required, func(r string) bool {
+		return r == "FormalAnswer"
+	})
+	return s
+}
+
+// strictSchema is the answer schema for structured outputs
+func strictSchema[ANSWER any]() (*jsonschema.Schema, error) {
+	return schema.Strict(answerSchema[ANSWER]())
+}
+
+func registered(provider string) bool {
+	for _, m := range client.Models() {
+		if m.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
+
+func interrupted(err error) error {
+	return fmt.Errorf("%w: %w", ErrInterrupted, err)
+}
+
+// computeAll runs a round of tool calls concurrently, returning results and errors in call order.
+// if abort, the first error cancels the other calls.
+func computeAll(ctx context.Context, tools map[string]Tool, calls []*client.FunctionCall, limit int, abort bool, events emitter) ([]string, []error) {
+	if limit <= 0 {
+		limit = len(calls)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]string, len(calls))
+	errs := make([]error, len(calls))
+	sem := make(chan struct{}, limit)
+	var mu sync.Mutex // serializes events
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			tool, ok := tools[call.Name]
+			switch {
+			case !ok:
+				errs[i] = fmt.Errorf("%w: %q", ErrUnknownTool, call.Name)
+			case !json.Valid([]byte(call.Arguments)):
+				errs[i] = fmt.Errorf("%w: %s", ErrInvalidArguments, call.Arguments)
+			default:
+				results[i], errs[i] = compute(ctx, tool, call.Arguments)
+			}
+			if errs[i] != nil && abort {
+				cancel() // no point in the others
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			events.emit(Event{Type: EventToolResult, Tool: call.Name, CallID: call.ID, Text: results[i], Err: errs[i]})
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// rootCause is the first error, preferring those that aren't cancellations they caused
+func rootCause(errs []error) error {
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compute runs the tool, abandoning it if ctx is done first
+func compute(ctx context.Context, t Tool, parameters string) (string, error) {
+	if ct, ok := t.(ContextTool); ok {
+		return ct.ComputeContext(ctx, parameters)
+	}
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := t.Compute(parameters)
+		done <- result{out, err}
+	}()
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 }
 
 func cleanText(s string) string {
@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/client"
+	"xoba.com/llm/client/fake"
+)
+
+func TestSelectModel(t *testing.T) {
+	m, err := selectModel("", client.Requirements{Provider: client.OllamaProvider, Tools: true})
+	if err != nil || !m.Tools {
+		t.Errorf("got %+v, %v for tools on ollama", m, err)
+	}
+	// llava sees images, but can't call tools:
+	_, err = selectModel("", client.Requirements{Provider: client.OllamaProvider, Tools: true, Images: true})
+	if err == nil || !strings.Contains(err.Error(), "can call tools") {
+		t.Errorf("got %v", err)
+	}
+	// unknown providers get their own default:
+	if m, err := selectModel("", client.Requirements{Provider: client.CompatibleProvider, Tools: true}); err != nil || len(m.Name) > 0 {
+		t.Errorf("got %+v, %v", m, err)
+	}
+	if _, err := selectModel("llava", client.Requirements{Provider: client.OllamaProvider, Tools: true}); err == nil {
+		t.Error("no error naming a model without tools")
+	}
+}
+
+// asking starts a fake openai server with the replies, returning a client for it
+func asking(t *testing.T, replies ...fake.Reply) (client.Interface, *fake.Server) {
+	t.Helper()
+	s := fake.OpenAI(replies...)
+	t.Cleanup(s.Close)
+	c, err := client.NewFromConfig(client.Config{Provider: client.OpenAIProvider, Key: "test", BaseURL: s.BaseURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+var answered = fake.Reply{Content: `{"ConversationalAnswer": "done", "FormalAnswer": "done"}`}
+
+type number struct {
+	N int `json:"n"`
+}
+
+// calls calls a tool with each n
+func calls(tool string, n ...int) fake.Reply {
+	var r fake.Reply
+	for _, n := range n {
+		r.ToolCalls = append(r.ToolCalls, fake.ToolCall{ID: fmt.Sprintf("call_%s_%d", tool, n), Name: tool, Arguments: fmt.Sprintf(`{"n":%d}`, n)})
+	}
+	return r
+}
+
+// toolMessages are the results given to the model, by call id
+func toolMessages(messages []openai.ChatCompletionMessage) (ids, contents []string) {
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleTool {
+			ids = append(ids, m.ToolCallID)
+			contents = append(contents, m.Content)
+		}
+	}
+	return ids, contents
+}
+
+func TestToolCalls(t *testing.T) {
+	var mu sync.Mutex
+	var running, most int
+	// later calls finish first:
+	square := NewTool("square", "squares n", func(_ context.Context, in number) (int, error) {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		mu.Unlock()
+		time.Sleep(time.Duration(6-in.N) * 10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return in.N * in.N, nil
+	})
+	for _, limit := range []int{0, 1, 2} {
+		running, most = 0, 0
+		c, _ := asking(t, calls("square", 1, 2, 3, 4, 5), answered)
+		resp, err := Ask(c, Question[string]{Prompt: "squares?", Tools: map[string]Tool{"square": square}, ToolConcurrency: limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, contents := toolMessages(resp.Messages)
+		if want := []string{"call_square_1", "call_square_2", "call_square_3", "call_square_4", "call_square_5"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("limit %d: results for %v", limit, ids)
+		}
+		if want := []string{"1", "4", "9", "16", "25"}; !reflect.DeepEqual(contents, want) {
+			t.Errorf("limit %d: results %v", limit, contents)
+		}
+		if want := map[int]int{0: 5, 1: 1, 2: 2}[limit]; most != want {
+			t.Errorf("limit %d: %d calls at once, want %d", limit, most, want)
+		}
+	}
+}
+
+var errOdd = errors.New("odd")
+
+// halve fails for odd n
+var halve = NewTool("halve", "halves even n", func(_ context.Context, in number) (int, error) {
+	if in.N%2 == 1 {
+		return 0, errOdd
+	}
+	return in.N / 2, nil
+})
+
+func TestAbortOnToolError(t *testing.T) {
+	// canceled by the failure, if it starts at all:
+	var waited atomic.Bool
+	wait := NewTool("wait", "waits", func(ctx context.Context, in number) (int, error) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			waited.Store(true)
+		}
+		return 0, ctx.Err()
+	})
+	reply := calls("wait", 1)
+	reply.ToolCalls = append(reply.ToolCalls, calls("halve", 2, 3).ToolCalls...)
+	c, s := asking(t, reply, answered)
+	_, err := Ask(c, Question[string]{Prompt: "halves?", Tools: map[string]Tool{"wait": wait, "halve": halve}})
+	if !errors.Is(err, errOdd) {
+		t.Errorf("got %v", err)
+	}
+	if waited.Load() {
+		t.Error("other calls not canceled")
+	}
+	if len(s.Requests()) != 1 {
+		t.Errorf("%d requests after aborting", len(s.Requests()))
+	}
+	// unknown tools abort before any is called:
+	c, _ = asking(t, calls("double", 2), answered)
+	if _, err := Ask(c, Question[string]{Prompt: "double?", Tools: map[string]Tool{"halve": halve}}); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("got %v for an unknown tool", err)
+	}
+}
+
+func TestReportToolErrors(t *testing.T) {
+	reply := calls("halve", 2, 3)
+	reply.ToolCalls = append(reply.ToolCalls, fake.ToolCall{ID: "call_double", Name: "double", Arguments: `{"n":2}`})
+	c, _ := asking(t, reply, calls("halve", 4), answered)
+	resp, err := Ask(c, Question[string]{Prompt: "halves?", Tools: map[string]Tool{"halve": halve}, ToolErrors: ReportToolErrors})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, contents := toolMessages(resp.Messages)
+	want := []string{"1", "error: odd", `error: unknown tool: "double"`, "2"}
+	if !reflect.DeepEqual(contents, want) {
+		t.Errorf("results %q, want %q", contents, want)
+	}
+	if len(resp.ToolErrors) != 2 || !errors.Is(resp.ToolErrors[0], errOdd) || resp.ToolErrors[0].CallID != "call_halve_3" || !errors.Is(resp.ToolErrors[1], ErrUnknownTool) {
+		t.Errorf("tool errors %v", resp.ToolErrors)
+	}
+	// errors are counted across rounds, up to the cap:
+	for _, test := range []struct {
+		max   int
+		fails bool
+	}{{3, false}, {2, true}} {
+		c, s := asking(t, calls("halve", 1, 3), calls("halve", 5), answered)
+		_, err := Ask(c, Question[string]{Prompt: "halves?", Tools: map[string]Tool{"halve": halve}, ToolErrors: ReportToolErrors, MaxToolErrors: test.max})
+		switch {
+		case test.fails && (err == nil || !strings.Contains(err.Error(), "too many tool errors") || !errors.Is(err, errOdd)):
+			t.Errorf("max %d: got %v", test.max, err)
+		case test.fails && len(s.Requests()) != 2:
+			t.Errorf("max %d: %d requests", test.max, len(s.Requests()))
+		case !test.fails && err != nil:
+			t.Errorf("max %d: %v", test.max, err)
+		}
+	}
+}
+
+func TestAskContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c, s := asking(t, answered)
+	if _, err := AskContext(ctx, c, Question[string]{Prompt: "hi"}); !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v", err)
+	}
+	if len(s.Requests()) != 0 {
+		t.Errorf("%d requests after canceling", len(s.Requests()))
+	}
+	// canceled by a tool, between rounds:
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	stop := NewTool("stop", "stops", func(ctx context.Context, in number) (int, error) {
+		cancel()
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	c, s = asking(t, calls("stop", 1), answered)
+	_, err := AskContext(ctx, c, Question[string]{Prompt: "stop?", Tools: map[string]Tool{"stop": stop}, ToolErrors: ReportToolErrors})
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v", err)
+	}
+	if len(s.Requests()) != 1 {
+		t.Errorf("%d requests after canceling", len(s.Requests()))
+	}
+}
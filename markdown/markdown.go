@@ -0,0 +1,38 @@
+// package markdown renders the markdown shared by the text extractors
+package markdown
+
+import "strings"
+
+// Table renders rows as a markdown table, the first being the header
+func Table(rows [][]string) string {
+	var width int
+	for _, r := range rows {
+		width = max(width, len(r))
+	}
+	if width == 0 {
+		return ""
+	}
+	var out strings.Builder
+	line := func(cells []string) {
+		out.WriteString("|")
+		for i := range width {
+			var c string
+			if i < len(cells) {
+				c = cells[i]
+			}
+			c = strings.Join(strings.Fields(c), " ")
+			out.WriteString(" " + strings.ReplaceAll(c, "|", `\|`) + " |")
+		}
+		out.WriteString("\n")
+	}
+	line(rows[0])
+	rule := make([]string, width)
+	for i := range rule {
+		rule[i] = "---"
+	}
+	line(rule)
+	for _, r := range rows[1:] {
+		line(r)
+	}
+	return out.String()
+}
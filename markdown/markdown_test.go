@@ -0,0 +1,20 @@
+package markdown
+
+import "testing"
+
+func TestTable(t *testing.T) {
+	for _, c := range []struct {
+		rows [][]string
+		want string
+	}{
+		{nil, ""},
+		{[][]string{{}}, ""},
+		{[][]string{{"a", "b"}, {"1", "2"}}, "| a | b |\n| --- | --- |\n| 1 | 2 |\n"},
+		// ragged rows are padded, pipes escaped and whitespace collapsed:
+		{[][]string{{"x"}, {"a|b", "two\n  lines"}}, "| x |  |\n| --- | --- |\n| a\\|b | two lines |\n"},
+	} {
+		if got := Table(c.rows); got != c.want {
+			t.Errorf("Table(%q) = %q, want %q", c.rows, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package office
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"xoba.com/llm/markdown"
+)
+
+// DOCX returns the text of a word document: its paragraphs, with headings
+// and list items marked as in markdown, and its tables as markdown tables
+func DOCX(data []byte) (string, error) {
+	a, err := open(data)
+	if err != nil {
+		return "", err
+	}
+	doc, err := a.read("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	body := doc.find("body")
+	if body == nil {
+		return "", nil
+	}
+	var blocks []string
+	wordBlocks(body, &blocks)
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+var headingStyle = regexp.MustCompile(`(?i)^heading\s*(\d)$`)
+
+// wordBlocks adds the paragraphs and tables within a node
+func wordBlocks(n *node, blocks *[]string) {
+	for _, c := range n.nodes {
+		switch c.name {
+		case "p":
+			if p := wordParagraph(c); len(p) > 0 {
+				*blocks = append(*blocks, p)
+			}
+		case "tbl":
+			var rows [][]string
+			for _, tr := range c.all("tr") {
+				var row []string
+				for _, tc := range tr.all("tc") {
+					var cell []string
+					wordBlocks(tc, &cell)
+					row = append(row, strings.Join(cell, " "))
+				}
+				rows = append(rows, row)
+			}
+			if t := markdown.Table(rows); len(t) > 0 {
+				*blocks = append(*blocks, strings.TrimSuffix(t, "\n"))
+			}
+		case "":
+		default:
+			// content controls, smart tags, insertions and so on:
+			wordBlocks(c, blocks)
+		}
+	}
+}
+
+// wordParagraph returns a paragraph's text, marked if it's a heading or list item
+func wordParagraph(p *node) string {
+	var text strings.Builder
+	var runs func(n *node)
+	runs = func(n *node) {
+		for _, c := range n.nodes {
+			switch c.name {
+			case "t":
+				text.WriteString(textOf(c))
+			case "tab":
+				text.WriteString("\t")
+			case "br", "cr":
+				text.WriteString("\n")
+			case "pPr", "rPr", "delText", "instrText", "":
+			default:
+				runs(c)
+			}
+		}
+	}
+	runs(p)
+	s := strings.TrimSpace(text.String())
+	if len(s) == 0 {
+		return ""
+	}
+	if props := p.child("pPr"); props != nil {
+		style := ""
+		if st := props.child("pStyle"); st != nil {
+			style = st.attr("val")
+		}
+		if m := headingStyle.FindStringSubmatch(style); m != nil {
+			level, _ := strconv.Atoi(m[1])
+			return strings.Repeat("#", min(max(level, 1), 6)) + " " + s
+		}
+		if strings.EqualFold(style, "title") {
+			return "# " + s
+		}
+		if props.child("numPr") != nil {
+			return "- " + s
+		}
+	}
+	return s
+}
+
+// textOf concatenates the text within a node
+func textOf(n *node) string {
+	if len(n.name) == 0 {
+		return n.text
+	}
+	var out strings.Builder
+	for _, c := range n.nodes {
+		out.WriteString(textOf(c))
+	}
+	return out.String()
+}
@@ -0,0 +1,126 @@
+package office
+
+import (
+	"strconv"
+	"strings"
+
+	"xoba.com/llm/markdown"
+)
+
+// ODT returns the text of an opendocument text file, marked up like DOCX
+func ODT(data []byte) (string, error) {
+	a, err := open(data)
+	if err != nil {
+		return "", err
+	}
+	doc, err := a.read("content.xml")
+	if err != nil {
+		return "", err
+	}
+	body := doc.find("body")
+	if body == nil {
+		return "", nil
+	}
+	var blocks []string
+	odfBlocks(body, 0, &blocks)
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+// odfBlocks adds the paragraphs, lists and tables within a node
+func odfBlocks(n *node, depth int, blocks *[]string) {
+	for _, c := range n.nodes {
+		switch c.name {
+		case "p":
+			if t := strings.TrimSpace(odfText(c)); len(t) > 0 {
+				*blocks = append(*blocks, t)
+			}
+		case "h":
+			if t := strings.TrimSpace(odfText(c)); len(t) > 0 {
+				level, err := strconv.Atoi(c.attr("outline-level"))
+				if err != nil {
+					level = 1
+				}
+				*blocks = append(*blocks, strings.Repeat("#", min(max(level, 1), 6))+" "+t)
+			}
+		case "list":
+			var items []string
+			for _, item := range c.nodes {
+				if item.name != "list-item" && item.name != "list-header" {
+					continue
+				}
+				var parts []string
+				odfBlocks(item, depth+1, &parts)
+				for i, p := range parts {
+					if i == 0 && !strings.HasPrefix(strings.TrimSpace(p), "- ") {
+						p = strings.Repeat("  ", depth) + "- " + p
+					}
+					items = append(items, p)
+				}
+			}
+			if len(items) > 0 {
+				*blocks = append(*blocks, strings.Join(items, "\n"))
+			}
+		case "table":
+			var rows [][]string
+			for _, tr := range c.all("table-row") {
+				var row []string
+				for _, tc := range tr.nodes {
+					if tc.name != "table-cell" && tc.name != "covered-table-cell" {
+						continue
+					}
+					var cell []string
+					odfBlocks(tc, 0, &cell)
+					repeat, err := strconv.Atoi(tc.attr("number-columns-repeated"))
+					if err != nil || repeat < 1 {
+						repeat = 1
+					}
+					// rows end with a huge run of repeated empty cells:
+					for range min(repeat, 64) {
+						row = append(row, strings.Join(cell, " "))
+					}
+				}
+				for len(row) > 0 && len(row[len(row)-1]) == 0 {
+					row = row[:len(row)-1]
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+			if t := markdown.Table(rows); len(t) > 0 {
+				*blocks = append(*blocks, strings.TrimSuffix(t, "\n"))
+			}
+		case "tracked-changes", "sequence-decls", "variable-decls", "user-field-decls", "":
+		default:
+			odfBlocks(c, depth, blocks)
+		}
+	}
+}
+
+// odfText is the text of a paragraph or heading
+func odfText(p *node) string {
+	var out strings.Builder
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, c := range n.nodes {
+			switch c.name {
+			case "":
+				out.WriteString(c.text)
+			case "s":
+				count, err := strconv.Atoi(c.attr("c"))
+				if err != nil || count < 1 {
+					count = 1
+				}
+				out.WriteString(strings.Repeat(" ", min(count, 64)))
+			case "tab":
+				out.WriteString("\t")
+			case "line-break":
+				out.WriteString("\n")
+			case "note-citation", "annotation", "bookmark-ref":
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(p)
+	return out.String()
+}
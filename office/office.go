@@ -0,0 +1,11 @@
+// package office extracts text from office documents (docx, xlsx, pptx and
+// odt) in pure go, rendering headings, lists and tables as markdown
+package office
+
+// content types of the documents
+const (
+	DOCXType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	XLSXType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	PPTXType = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	ODTType  = "application/vnd.oasis.opendocument.text"
+)
@@ -0,0 +1,142 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipped zips files, by name
+func zipped(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	z := zip.NewWriter(&b)
+	for name, content := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+const (
+	wordNS = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	relsNS = `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	pptNS  = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" ` + relsNS
+)
+
+// contains fails unless text has every part
+func contains(t *testing.T, text string, parts ...string) {
+	t.Helper()
+	for _, p := range parts {
+		if !strings.Contains(text, p) {
+			t.Errorf("missing %q in:\n%s", p, text)
+		}
+	}
+}
+
+func TestDOCX(t *testing.T) {
+	data := zipped(t, map[string]string{"word/document.xml": `<w:document ` + wordNS + `><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Report</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Hello </w:t></w:r><w:r><w:t>world</w:t></w:r><w:del><w:r><w:delText>gone</w:delText></w:r></w:del></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>item one</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Qty</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>a|b</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>3</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`})
+	text, err := DOCX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contains(t, text, "# Report", "Hello world", "- item one", "| Name | Qty |", `| a\|b | 3 |`)
+	if strings.Contains(text, "gone") {
+		t.Errorf("deleted text in:\n%s", text)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data := zipped(t, map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` + relsNS + `><sheets><sheet name="Sales" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Type="x/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="x/worksheet" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>Region</t></si><si><r><t>To</t></r><r><t>tal</t></r></si><si><t>North</t></si></sst>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData><row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row><row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2" t="b"><v>1</v></c><c r="C2"><f>SUM(1,2)</f><v>3</v></c><c r="DDDDDDDDDDDDDD2"><v>overflow</v></c><c r="XFE2"><v>past</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml":   `<worksheet><sheetData/></worksheet>`,
+	})
+	sheets, err := XLSX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 2 || sheets[0].Name != "Sales" || sheets[1].Name != "Empty" {
+		t.Fatalf("got %+v", sheets)
+	}
+	contains(t, sheets[0].Markdown(), "## Sales", "| Region |  | Total |", "| North | TRUE | 3 |")
+	contains(t, sheets[1].Markdown(), "(empty)")
+}
+
+func TestColumn(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "Z9": 25, "AA1": 26, "ab12": 27, "XFD1": 1<<14 - 1} {
+		if n, ok := column(ref); !ok || n != want {
+			t.Errorf("column(%q) = %d, %v; want %d", ref, n, ok, want)
+		}
+	}
+	for _, ref := range []string{"", "1", "XFE1", "DDDDDDDDDDDDDD1", strings.Repeat("Z", 40)} {
+		if n, ok := column(ref); ok {
+			t.Errorf("column(%q) = %d, want rejection", ref, n)
+		}
+	}
+}
+
+func TestPPTX(t *testing.T) {
+	data := zipped(t, map[string]string{
+		"ppt/presentation.xml":             `<p:presentation ` + pptNS + `><p:sldIdLst><p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId3"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels":  `<Relationships><Relationship Id="rId2" Type="x/slide" Target="slides/slide1.xml"/><Relationship Id="rId3" Type="x/slide" Target="slides/slide2.xml"/></Relationships>`,
+		"ppt/slides/slide1.xml":            `<p:sld ` + pptNS + `><p:cSld><p:spTree><p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>First</a:t></a:r></a:p></p:txBody></p:sp><p:sp><p:txBody><a:p><a:r><a:t>bullet a</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/_rels/slide1.xml.rels": `<Relationships><Relationship Id="rId1" Type="http://x/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/></Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml":  `<p:notes ` + pptNS + `><p:cSld><p:spTree><p:sp><p:nvSpPr><p:nvPr><p:ph type="body"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>say this</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:notes>`,
+		"ppt/slides/slide2.xml":            `<p:sld ` + pptNS + `><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>second</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`,
+	})
+	slides, err := PPTX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slides) != 2 || slides[0].Number != 1 || slides[1].Number != 2 {
+		t.Fatalf("got %+v", slides)
+	}
+	contains(t, slides[0].Text, "# First", "bullet a")
+	contains(t, slides[1].Text, "second")
+	if slides[0].Notes != "say this" || slides[1].Notes != "" {
+		t.Errorf("notes %q, %q", slides[0].Notes, slides[1].Notes)
+	}
+}
+
+func TestODT(t *testing.T) {
+	data := zipped(t, map[string]string{"content.xml": `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"><office:body><office:text>
+<text:h text:outline-level="2">Intro</text:h><text:p>a<text:s text:c="3"/>b<text:span>c</text:span></text:p>
+<text:list><text:list-item><text:p>one</text:p><text:list><text:list-item><text:p>nested</text:p></text:list-item></text:list></text:list-item></text:list>
+<table:table><table:table-row><table:table-cell><text:p>x</text:p></table:table-cell><table:table-cell table:number-columns-repeated="2"><text:p>y</text:p></table:table-cell></table:table-row></table:table>
+</office:text></office:body></office:document-content>`})
+	text, err := ODT(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contains(t, text, "## Intro", "a   bc", "- one", "  - nested", "| x | y | y |")
+}
+
+func TestNotZip(t *testing.T) {
+	for name, extract := range map[string]func([]byte) (string, error){"docx": DOCX, "odt": ODT} {
+		if _, err := extract([]byte("junk")); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if _, err := XLSX([]byte("junk")); err == nil {
+		t.Error("xlsx: no error")
+	}
+	if _, err := PPTX([]byte("junk")); err == nil {
+		t.Error("pptx: no error")
+	}
+}
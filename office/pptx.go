@@ -0,0 +1,137 @@
+package office
+
+import (
+	"strings"
+
+	"xoba.com/llm/markdown"
+)
+
+// Slide is the text of a slide, numbered from 1, and its speaker notes
+type Slide struct {
+	Number int
+	Text   string // the title marked as a markdown heading, tables as markdown tables
+	Notes  string
+}
+
+// PPTX returns the slides of a powerpoint presentation, in order, skipping hidden ones
+func PPTX(data []byte) ([]Slide, error) {
+	a, err := open(data)
+	if err != nil {
+		return nil, err
+	}
+	const presentation = "ppt/presentation.xml"
+	pres, err := a.read(presentation)
+	if err != nil {
+		return nil, err
+	}
+	targets, _ := a.relationships(presentation)
+	var out []Slide
+	for _, id := range pres.all("sldId") {
+		target, ok := targets[id.rel()]
+		if !ok || !a.has(target) {
+			continue
+		}
+		slide, err := a.read(target)
+		if err != nil {
+			return nil, err
+		}
+		if s := slide.child("sld"); s != nil && (s.attr("show") == "0" || s.attr("show") == "false") {
+			continue
+		}
+		s := Slide{Number: len(out) + 1, Text: slideText(slide)}
+		notes, types := a.relationships(target)
+		for id, t := range types {
+			if strings.HasSuffix(t, "/notesSlide") && a.has(notes[id]) {
+				n, err := a.read(notes[id])
+				if err != nil {
+					return nil, err
+				}
+				s.Notes = slideText(n)
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// slideText returns the text of a slide's shapes and tables, in order
+func slideText(slide *node) string {
+	var blocks []string
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, c := range n.nodes {
+			switch c.name {
+			case "sp":
+				kind := ""
+				if ph := c.find("ph"); ph != nil {
+					kind = ph.attr("type")
+				}
+				switch kind {
+				case "sldImg", "sldNum", "hdr", "ftr", "dt":
+					continue
+				}
+				body := c.child("txBody")
+				if body == nil {
+					continue
+				}
+				var lines []string
+				for _, p := range body.all("p") {
+					if t := strings.TrimSpace(drawingText(p)); len(t) > 0 {
+						lines = append(lines, t)
+					}
+				}
+				text := strings.Join(lines, "\n")
+				if len(text) == 0 {
+					continue
+				}
+				if kind == "title" || kind == "ctrTitle" {
+					text = "# " + strings.ReplaceAll(text, "\n", " ")
+				}
+				blocks = append(blocks, text)
+			case "tbl":
+				var rows [][]string
+				for _, tr := range c.all("tr") {
+					var row []string
+					for _, tc := range tr.all("tc") {
+						var cell []string
+						for _, p := range tc.all("p") {
+							cell = append(cell, drawingText(p))
+						}
+						row = append(row, strings.Join(cell, " "))
+					}
+					rows = append(rows, row)
+				}
+				if t := markdown.Table(rows); len(t) > 0 {
+					blocks = append(blocks, strings.TrimSuffix(t, "\n"))
+				}
+			case "":
+			default:
+				// groups, graphic frames and so on:
+				walk(c)
+			}
+		}
+	}
+	walk(slide)
+	return strings.Join(blocks, "\n\n")
+}
+
+// drawingText is the text of a drawingml paragraph
+func drawingText(p *node) string {
+	var out strings.Builder
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, c := range n.nodes {
+			switch c.name {
+			case "t":
+				out.WriteString(textOf(c))
+			case "br":
+				out.WriteString("\n")
+			case "pPr", "rPr", "":
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(p)
+	return out.String()
+}
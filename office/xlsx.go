@@ -0,0 +1,166 @@
+package office
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"xoba.com/llm/markdown"
+)
+
+// Sheet is a worksheet's cells, as text
+type Sheet struct {
+	Name string
+	Rows [][]string // without empty rows, or empty columns on the right
+}
+
+// Markdown renders the sheet as a markdown table headed by its name
+func (s Sheet) Markdown() string {
+	if len(s.Rows) == 0 {
+		return fmt.Sprintf("## %s\n\n(empty)\n", s.Name)
+	}
+	return fmt.Sprintf("## %s\n\n%s", s.Name, markdown.Table(s.Rows))
+}
+
+// XLSX returns the sheets of an excel workbook, in order. cells hold their
+// cached values, so formulas show their results; dates show as serial numbers.
+func XLSX(data []byte) ([]Sheet, error) {
+	a, err := open(data)
+	if err != nil {
+		return nil, err
+	}
+	const book = "xl/workbook.xml"
+	wb, err := a.read(book)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if a.has("xl/sharedStrings.xml") {
+		ss, err := a.read("xl/sharedStrings.xml")
+		if err != nil {
+			return nil, err
+		}
+		for _, si := range ss.all("si") {
+			shared = append(shared, richText(si))
+		}
+	}
+	targets, _ := a.relationships(book)
+	var out []Sheet
+	for _, s := range wb.all("sheet") {
+		target, ok := targets[s.rel()]
+		if !ok || !a.has(target) {
+			continue // a chart sheet, or missing
+		}
+		ws, err := a.read(target)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Sheet{Name: s.attr("name"), Rows: cells(ws, shared)})
+	}
+	return out, nil
+}
+
+// richText is the text of a shared or inline string, without phonetic hints
+func richText(n *node) string {
+	var out strings.Builder
+	for _, c := range n.nodes {
+		switch c.name {
+		case "t":
+			out.WriteString(textOf(c))
+		case "r":
+			out.WriteString(richText(c))
+		}
+	}
+	return out.String()
+}
+
+// cells reads a worksheet's grid
+func cells(ws *node, shared []string) [][]string {
+	var rows [][]string
+	next := 0 // row index, for rows without references
+	for _, r := range ws.all("row") {
+		index := next
+		if n, err := strconv.Atoi(r.attr("r")); err == nil && n > 0 {
+			index = n - 1
+		}
+		next = index + 1
+		var row []string
+		col := 0
+		for _, c := range r.all("c") {
+			if ref := c.attr("r"); len(ref) > 0 {
+				if n, ok := column(ref); ok {
+					col = n
+				}
+			}
+			v := value(c, shared)
+			if len(v) > 0 {
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = v
+			}
+			col++
+		}
+		if len(row) > 0 && index < 1<<20 {
+			for len(rows) <= index {
+				rows = append(rows, nil)
+			}
+			rows[index] = row
+		}
+	}
+	// drop empty rows:
+	var out [][]string
+	for _, r := range rows {
+		if len(r) > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// column parses the column of a cell reference like "AB12", from 0. columns
+// past excel's last, XFD, are rejected before they can overflow.
+func column(ref string) (int, bool) {
+	n := 0
+	for i, c := range ref {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			n = n*26 + int(c-'A') + 1
+		case c >= 'a' && c <= 'z':
+			n = n*26 + int(c-'a') + 1
+		default:
+			return n - 1, i > 0 && n > 0 && n <= 1<<14
+		}
+		if n > 1<<14 {
+			return 0, false
+		}
+	}
+	return n - 1, n > 0 && n <= 1<<14
+}
+
+func value(c *node, shared []string) string {
+	var v string
+	if x := c.child("v"); x != nil {
+		v = textOf(x)
+	}
+	switch c.attr("t") {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return shared[i]
+	case "inlineStr":
+		if is := c.child("is"); is != nil {
+			return richText(is)
+		}
+	case "b":
+		switch v {
+		case "1":
+			return "TRUE"
+		case "0":
+			return "FALSE"
+		}
+	}
+	return v
+}
@@ -0,0 +1,174 @@
+package office
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxMember limits the uncompressed size of any one part of a document
+const maxMember = 256 << 20
+
+// node is an xml element, or a run of text if it has no name
+type node struct {
+	name  string // local name, namespaces being ignored
+	attrs []xml.Attr
+	nodes []*node
+	text  string
+}
+
+// attr returns the value of an attribute, by local name
+func (n *node) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// rel returns the id of a relationship an element refers to, its r:id
+func (n *node) rel() string {
+	for _, a := range n.attrs {
+		if a.Name.Local == "id" && strings.HasSuffix(a.Name.Space, "/relationships") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with a name
+func (n *node) child(name string) *node {
+	for _, c := range n.nodes {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant element with a name, depth first
+func (n *node) find(name string) *node {
+	for _, c := range n.nodes {
+		if c.name == name {
+			return c
+		}
+		if x := c.find(name); x != nil {
+			return x
+		}
+	}
+	return nil
+}
+
+// all returns every descendant element with a name, not looking inside matches
+func (n *node) all(name string) []*node {
+	var out []*node
+	for _, c := range n.nodes {
+		if c.name == name {
+			out = append(out, c)
+			continue
+		}
+		out = append(out, c.all(name)...)
+	}
+	return out
+}
+
+func parseXML(r io.Reader) (*node, error) {
+	d := xml.NewDecoder(r)
+	root := &node{}
+	stack := []*node{root}
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := t.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local, attrs: t.Attr}
+			top.nodes = append(top.nodes, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			top.nodes = append(top.nodes, &node{text: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// archive is the zip container of a document
+type archive struct {
+	files map[string]*zip.File
+}
+
+func open(data []byte) (*archive, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	a := &archive{files: make(map[string]*zip.File)}
+	for _, f := range z.File {
+		a.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return a, nil
+}
+
+func (a *archive) has(name string) bool {
+	_, ok := a.files[name]
+	return ok
+}
+
+// read parses an xml part of the document
+func (a *archive) read(name string) (*node, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", name)
+	}
+	if f.UncompressedSize64 > maxMember {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	n, err := parseXML(io.LimitReader(r, maxMember))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return n, nil
+}
+
+// relationships maps the ids of a part's relationships to their targets,
+// as paths within the archive, and their types
+func (a *archive) relationships(part string) (map[string]string, map[string]string) {
+	targets, types := make(map[string]string), make(map[string]string)
+	rels, err := a.read(path.Join(path.Dir(part), "_rels", path.Base(part)+".rels"))
+	if err != nil {
+		return targets, types
+	}
+	for _, r := range rels.all("Relationship") {
+		if r.attr("TargetMode") == "External" {
+			continue
+		}
+		target := r.attr("Target")
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(path.Dir(part), target)
+		}
+		targets[r.attr("Id")] = target
+		types[r.attr("Id")] = r.attr("Type")
+	}
+	return targets, types
+}
@@ -0,0 +1,317 @@
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"strings"
+)
+
+// matrix is an affine transform [a b c d e f]
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m×n, applying m first
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+// fragment is a run of text shown at one place on the page
+type fragment struct {
+	x, y, end float64 // start and end of the baseline, in user space
+	size      float64 // effective font size
+	text      string
+}
+
+// gstate is the graphics state relevant to text
+type gstate struct {
+	ctm                                 matrix
+	font                                *font
+	size, charSpace, wordSpace, leading float64
+	scale, rise                         float64
+}
+
+// interpreter runs content streams, collecting the text they show
+type interpreter struct {
+	d         *document
+	fonts     map[any]*font // by font dictionary reference, or name for direct ones
+	fragments []fragment
+	depth     int // of form xobjects
+}
+
+func (in *interpreter) run(content []byte, resources dict, g gstate) {
+	var stack []gstate
+	var tm, tlm matrix
+	var operands []any
+	show := func(s []byte) {
+		if g.font == nil {
+			return
+		}
+		var text strings.Builder
+		trm := matrix{g.size * g.scale, 0, 0, g.size, 0, g.rise}.mul(tm).mul(g.ctm)
+		start := trm
+		for _, gl := range g.font.decode(s) {
+			text.WriteString(gl.text)
+			tx := gl.width/1000*g.size + g.charSpace
+			if gl.space {
+				tx += g.wordSpace
+			}
+			tm = translate(tx*g.scale, 0).mul(tm)
+		}
+		end := matrix{g.size * g.scale, 0, 0, g.size, 0, g.rise}.mul(tm).mul(g.ctm)
+		if text.Len() == 0 {
+			return
+		}
+		in.fragments = append(in.fragments, fragment{
+			x:    start[4],
+			y:    start[5],
+			end:  end[4],
+			size: math.Hypot(start[2], start[3]),
+			text: text.String(),
+		})
+	}
+	nextLine := func(tx, ty float64) {
+		tlm = translate(tx, ty).mul(tlm)
+		tm = tlm
+	}
+	num := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		f, _ := number(operands[i])
+		return f
+	}
+	str := func(i int) []byte {
+		if i < 0 || i >= len(operands) {
+			return nil
+		}
+		s, _ := operands[i].([]byte)
+		return s
+	}
+	p := &parser{b: content}
+	for !p.eof() {
+		x, err := p.object()
+		if err != nil {
+			return
+		}
+		op, ok := x.(keyword)
+		if !ok {
+			operands = append(operands, x)
+			continue
+		}
+		n := len(operands)
+		switch op {
+		case "q":
+			stack = append(stack, g)
+		case "Q":
+			if len(stack) > 0 {
+				g = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if n >= 6 {
+				g.ctm = matrix{num(n - 6), num(n - 5), num(n - 4), num(n - 3), num(n - 2), num(n - 1)}.mul(g.ctm)
+			}
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if n >= 2 {
+				if f, ok := operands[n-2].(name); ok {
+					g.font = in.font(resources, f)
+				}
+				g.size = num(n - 1)
+			}
+		case "Tc":
+			g.charSpace = num(n - 1)
+		case "Tw":
+			g.wordSpace = num(n - 1)
+		case "Tz":
+			g.scale = num(n-1) / 100
+		case "TL":
+			g.leading = num(n - 1)
+		case "Ts":
+			g.rise = num(n - 1)
+		case "Td":
+			nextLine(num(n-2), num(n-1))
+		case "TD":
+			g.leading = -num(n - 1)
+			nextLine(num(n-2), num(n-1))
+		case "Tm":
+			if n >= 6 {
+				tlm = matrix{num(n - 6), num(n - 5), num(n - 4), num(n - 3), num(n - 2), num(n - 1)}
+				tm = tlm
+			}
+		case "T*":
+			nextLine(0, -g.leading)
+		case "Tj":
+			show(str(n - 1))
+		case "'":
+			nextLine(0, -g.leading)
+			show(str(n - 1))
+		case "\"":
+			g.wordSpace, g.charSpace = num(n-3), num(n-2)
+			nextLine(0, -g.leading)
+			show(str(n - 1))
+		case "TJ":
+			if n >= 1 {
+				items, _ := operands[n-1].(array)
+				for _, item := range items {
+					switch item := item.(type) {
+					case []byte:
+						show(item)
+					default:
+						if f, ok := number(item); ok {
+							tm = translate(-f/1000*g.size*g.scale, 0).mul(tm)
+						}
+					}
+				}
+			}
+		case "Do":
+			if n >= 1 {
+				if xn, ok := operands[n-1].(name); ok {
+					in.form(resources, xn, g)
+				}
+			}
+		case "ID":
+			// skip inline image data, up to whitespace, "EI", whitespace:
+			for i := p.pos; i+2 < len(p.b); i++ {
+				if isSpace(p.b[i]) && p.b[i+1] == 'E' && p.b[i+2] == 'I' && (i+3 == len(p.b) || isSpace(p.b[i+3])) {
+					p.pos = i + 3
+					break
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func (in *interpreter) font(resources dict, n name) *font {
+	fonts := in.d.dict(resources["Font"])
+	x := fonts[n]
+	key := x
+	if _, ok := x.(ref); !ok {
+		key = n
+	}
+	if f, ok := in.fonts[key]; ok {
+		return f
+	}
+	fd := in.d.dict(x)
+	if fd == nil {
+		return nil
+	}
+	f := in.d.font(fd)
+	in.fonts[key] = f
+	return f
+}
+
+// form runs a form xobject
+func (in *interpreter) form(resources dict, n name, g gstate) {
+	s, ok := in.d.resolve(in.d.dict(resources["XObject"])[n]).(stream)
+	if !ok || s.dict["Subtype"] != name("Form") || in.depth > 16 {
+		return
+	}
+	data, err := in.d.decode(s)
+	if err != nil {
+		return
+	}
+	if m := in.d.array(s.dict["Matrix"]); len(m) == 6 {
+		var fm matrix
+		for i := range fm {
+			fm[i] = in.d.number(m[i])
+		}
+		g.ctm = fm.mul(g.ctm)
+	}
+	if r := in.d.dict(s.dict["Resources"]); r != nil {
+		resources = r
+	}
+	in.depth++
+	in.run(data, resources, g)
+	in.depth--
+}
+
+// layout orders fragments into lines, top to bottom and left to right
+func layout(fragments []fragment) string {
+	if len(fragments) == 0 {
+		return ""
+	}
+	slices.SortStableFunc(fragments, func(a, b fragment) int {
+		switch {
+		case a.y > b.y:
+			return -1
+		case a.y < b.y:
+			return 1
+		}
+		return 0
+	})
+	type line struct {
+		y, size   float64
+		fragments []fragment
+	}
+	var lines []*line
+	for _, f := range fragments {
+		size := max(f.size, 1)
+		if n := len(lines); n > 0 && math.Abs(lines[n-1].y-f.y) < 0.5*min(size, lines[n-1].size) {
+			lines[n-1].fragments = append(lines[n-1].fragments, f)
+			continue
+		}
+		lines = append(lines, &line{y: f.y, size: size, fragments: []fragment{f}})
+	}
+	var out strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			out.WriteString("\n")
+			// a blank line for paragraph-sized gaps:
+			if lines[i-1].y-l.y > 2*max(l.size, lines[i-1].size) {
+				out.WriteString("\n")
+			}
+		}
+		slices.SortStableFunc(l.fragments, func(a, b fragment) int {
+			switch {
+			case a.x < b.x:
+				return -1
+			case a.x > b.x:
+				return 1
+			}
+			return 0
+		})
+		var text strings.Builder
+		for j, f := range l.fragments {
+			if j > 0 {
+				prev := l.fragments[j-1]
+				gap := f.x - prev.end
+				spaced := strings.HasSuffix(text.String(), " ") || strings.HasPrefix(f.text, " ")
+				if !spaced && gap > 0.15*max(f.size, 1) {
+					text.WriteString(" ")
+				}
+			}
+			text.WriteString(f.text)
+		}
+		out.WriteString(strings.TrimRight(text.String(), " "))
+	}
+	return cleanup(out.String())
+}
+
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "\u00a0", " ", "\u00ad", "")
+
+// cleanup expands ligatures and drops control characters
+func cleanup(s string) string {
+	s = ligatures.Replace(s)
+	return string(bytes.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, []byte(s)))
+}
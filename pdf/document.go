@@ -0,0 +1,469 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// ErrEncrypted is returned for encrypted pdfs, which aren't supported
+var ErrEncrypted = errors.New("encrypted pdf")
+
+// document holds every object of a file, found by scanning rather than by
+// trusting the cross-reference tables, which are often broken
+type document struct {
+	objects map[int]any
+	trailer dict
+}
+
+// maxStream limits the decoded size of any one stream, against compression
+// bombs; a variable, for tests
+var maxStream = 256 << 20
+
+var objPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func parse(data []byte) (*document, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a pdf")
+	}
+	d := &document{objects: make(map[int]any)}
+	var streams []stream
+	var trailers []dict
+	trailer := -1 // offset of the next "trailer" keyword, found lazily
+	for pos := 0; pos < len(data); {
+		m := objPattern.FindSubmatchIndex(data[pos:])
+		if trailer < pos {
+			trailer = len(data)
+			if t := bytes.Index(data[pos:], []byte("trailer")); t >= 0 {
+				trailer = pos + t
+			}
+		}
+		if trailer < len(data) && (m == nil || trailer < pos+m[0]) {
+			p := &parser{b: data, pos: trailer + len("trailer")}
+			if x, err := p.object(); err == nil {
+				if td, ok := x.(dict); ok {
+					trailers = append(trailers, td)
+				}
+			}
+			pos = p.pos
+			continue
+		}
+		if m == nil {
+			break
+		}
+		start := pos + m[0]
+		if start > 0 && isRegular(data[start-1]) {
+			pos = pos + m[1] // the tail of some other token
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[pos+m[2] : pos+m[3]]))
+		p := &parser{b: data, pos: pos + m[1]}
+		x, err := d.indirect(p)
+		if err != nil {
+			pos = pos + m[1]
+			continue
+		}
+		d.objects[num] = x // later definitions win, as with incremental updates
+		if s, ok := x.(stream); ok {
+			streams = append(streams, s)
+			if s.dict["Type"] == name("XRef") {
+				trailers = append(trailers, s.dict)
+			}
+		}
+		pos = p.pos
+	}
+	// objects packed in object streams, unless defined directly:
+	for _, s := range streams {
+		if s.dict["Type"] != name("ObjStm") {
+			continue
+		}
+		if err := d.unpack(s); err != nil {
+			continue
+		}
+	}
+	for _, t := range trailers {
+		// merge, later trailers winning:
+		if d.trailer == nil {
+			d.trailer = make(dict)
+		}
+		for k, v := range t {
+			d.trailer[k] = v
+		}
+	}
+	if d.trailer != nil && d.trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+	if d.root() == nil {
+		return nil, fmt.Errorf("no document catalog")
+	}
+	return d, nil
+}
+
+// indirect reads the body of an indirect object, after its "obj" keyword
+func (d *document) indirect(p *parser) (any, error) {
+	x, err := p.object()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := x.(dict)
+	if !ok {
+		return x, nil
+	}
+	save := p.pos
+	p.skipSpace()
+	if !bytes.HasPrefix(p.b[p.pos:], []byte("stream")) {
+		p.pos = save
+		return h, nil
+	}
+	p.pos += len("stream")
+	if p.pos < len(p.b) && p.b[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	// trust the length only if endstream follows it:
+	if n, ok := d.resolve(h["Length"]).(int); ok && n >= 0 && start+n <= len(p.b) {
+		q := &parser{b: p.b, pos: start + n}
+		q.skipSpace()
+		if bytes.HasPrefix(p.b[q.pos:], []byte("endstream")) {
+			p.pos = q.pos + len("endstream")
+			return stream{dict: h, data: p.b[start : start+n]}, nil
+		}
+	}
+	end := bytes.Index(p.b[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated stream")
+	}
+	data := p.b[start : start+end]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	p.pos = start + end + len("endstream")
+	return stream{dict: h, data: data}, nil
+}
+
+// unpack adds the objects of an object stream
+func (d *document) unpack(s stream) error {
+	data, err := d.decode(s)
+	if err != nil {
+		return err
+	}
+	n, _ := d.resolve(s.dict["N"]).(int)
+	first, _ := d.resolve(s.dict["First"]).(int)
+	if first < 0 || first > len(data) {
+		return fmt.Errorf("bad object stream")
+	}
+	header := &parser{b: data[:first]}
+	for range n {
+		num, err1 := header.object()
+		off, err2 := header.object()
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("bad object stream header")
+		}
+		num2, ok1 := num.(int)
+		off2, ok2 := off.(int)
+		if !ok1 || !ok2 || off2 < 0 || first+off2 < 0 || first+off2 > len(data) {
+			return fmt.Errorf("bad object stream header")
+		}
+		if _, ok := d.objects[num2]; ok {
+			continue
+		}
+		p := &parser{b: data, pos: first + off2}
+		if x, err := p.object(); err == nil {
+			d.objects[num2] = x
+		}
+	}
+	return nil
+}
+
+// resolve follows references
+func (d *document) resolve(x any) any {
+	for range 32 {
+		r, ok := x.(ref)
+		if !ok {
+			return x
+		}
+		x = d.objects[r.num]
+	}
+	return nil
+}
+
+func (d *document) dict(x any) dict {
+	switch x := d.resolve(x).(type) {
+	case dict:
+		return x
+	case stream:
+		return x.dict
+	}
+	return nil
+}
+
+func (d *document) array(x any) array {
+	a, _ := d.resolve(x).(array)
+	return a
+}
+
+func (d *document) number(x any) float64 {
+	f, _ := number(d.resolve(x))
+	return f
+}
+
+func (d *document) root() dict {
+	if r := d.dict(d.trailer["Root"]); r != nil {
+		return r
+	}
+	for _, x := range d.objects {
+		if h, ok := x.(dict); ok && h["Type"] == name("Catalog") {
+			return h
+		}
+	}
+	return nil
+}
+
+// decode applies a stream's filters
+func (d *document) decode(s stream) ([]byte, error) {
+	data := s.data
+	var filters array
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = array{f}
+	case array:
+		filters = f
+	}
+	params := d.array(s.dict["DecodeParms"])
+	for i, f := range filters {
+		var parms dict
+		if i < len(params) {
+			parms = d.dict(params[i])
+		} else if i == 0 {
+			parms = d.dict(s.dict["DecodeParms"])
+		}
+		var err error
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+			if err == nil {
+				data, err = d.predict(data, parms)
+			}
+		case name("ASCIIHexDecode"), name("AHx"):
+			data, err = asciiHex(data)
+		case name("ASCII85Decode"), name("A85"):
+			data, err = ascii85Decode(data)
+		case name("RunLengthDecode"), name("RL"):
+			data, err = runLength(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping whatever precedes any corruption,
+// but failing past maxStream
+func inflate(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		if len(data) < 2 {
+			return nil, err
+		}
+		r = flate.NewReader(bytes.NewReader(data[2:]))
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxStream)+1))
+	if len(out) > maxStream {
+		return nil, fmt.Errorf("stream inflates past %d bytes", maxStream)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// predict undoes png predictors, as used by some object streams
+func (d *document) predict(data []byte, parms dict) ([]byte, error) {
+	predictor, _ := d.resolve(parms["Predictor"]).(int)
+	if predictor < 10 {
+		return data, nil
+	}
+	columns := 1
+	if c, ok := d.resolve(parms["Columns"]).(int); ok && c > 0 {
+		columns = c
+	}
+	colors := 1
+	if c, ok := d.resolve(parms["Colors"]).(int); ok && c > 0 {
+		colors = c
+	}
+	bpc := 8
+	if b, ok := d.resolve(parms["BitsPerComponent"]).(int); ok && b > 0 {
+		bpc = b
+	}
+	bpp := max(1, colors*bpc/8)
+	row := (columns*colors*bpc + 7) / 8
+	var out []byte
+	prev := make([]byte, row)
+	for len(data) >= row+1 {
+		kind, cur := data[0], append([]byte(nil), data[1:row+1]...)
+		data = data[row+1:]
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func asciiHex(data []byte) ([]byte, error) {
+	if i := bytes.IndexByte(data, '>'); i >= 0 {
+		data = data[:i]
+	}
+	p := &parser{b: append(append([]byte("<"), data...), '>')}
+	x, err := p.hex()
+	if err != nil {
+		return nil, err
+	}
+	return x.([]byte), nil
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+func runLength(data []byte) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(data); {
+		if len(out) > maxStream {
+			return nil, fmt.Errorf("stream decodes past %d bytes", maxStream)
+		}
+		n := int(data[i])
+		i++
+		switch {
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case n > 128 && i < len(data):
+			out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+			i++
+		default:
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// page is a leaf of the page tree, with its inherited resources
+type page struct {
+	dict      dict
+	resources dict
+}
+
+func (d *document) pages() []page {
+	var out []page
+	seen := make(map[ref]bool)
+	var walk func(x any, resources dict, depth int)
+	walk = func(x any, resources dict, depth int) {
+		if r, ok := x.(ref); ok {
+			if seen[r] {
+				return
+			}
+			seen[r] = true
+		}
+		node := d.dict(x)
+		if node == nil || depth > 64 {
+			return
+		}
+		if r := d.dict(node["Resources"]); r != nil {
+			resources = r
+		}
+		kids := d.array(node["Kids"])
+		if node["Type"] == name("Page") || (kids == nil && node["Contents"] != nil) {
+			out = append(out, page{dict: node, resources: resources})
+			return
+		}
+		for _, k := range kids {
+			walk(k, resources, depth+1)
+		}
+	}
+	walk(d.root()["Pages"], nil, 0)
+	return out
+}
+
+// contents returns a page's content streams, decoded and concatenated
+func (d *document) contents(p page) []byte {
+	var parts []any
+	switch c := d.resolve(p.dict["Contents"]).(type) {
+	case array:
+		parts = c
+	case stream:
+		parts = []any{c}
+	}
+	var out []byte
+	for _, x := range parts {
+		s, ok := d.resolve(x).(stream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		out = append(out, data...)
+		out = append(out, '\n')
+	}
+	return out
+}
@@ -0,0 +1,437 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// font decodes the codes of shown strings into text and widths
+type font struct {
+	composite bool              // multi-byte codes, as in Type0 fonts
+	codespace []codeRange       // valid codes of composite fonts
+	toUnicode map[string]string // code bytes to text, from the ToUnicode cmap
+	encoding  [256]string       // code to text, for simple fonts
+	widths    map[int]float64   // code, or cid, to width in thousandths of an em
+	missing   float64           // width of codes without one
+	scale     float64           // from glyph space to thousandths of an em
+}
+
+type codeRange struct {
+	lo, hi []byte
+}
+
+// glyph is one decoded code
+type glyph struct {
+	text  string
+	width float64 // in thousandths of an em
+	space bool    // the single-byte code 32, subject to word spacing
+}
+
+func (d *document) font(f dict) *font {
+	x := &font{
+		widths:  make(map[int]float64),
+		missing: 500,
+		scale:   1,
+	}
+	subtype := d.resolve(f["Subtype"])
+	if m := d.array(f["FontMatrix"]); subtype == name("Type3") && len(m) > 0 {
+		x.scale = d.number(m[0]) * 1000
+	}
+	if s, ok := d.resolve(f["ToUnicode"]).(stream); ok {
+		if data, err := d.decode(s); err == nil {
+			x.toUnicode, x.codespace = parseCMap(data)
+		}
+	}
+	if subtype == name("Type0") {
+		x.composite = true
+		x.missing = 1000
+		if descendants := d.array(f["DescendantFonts"]); len(descendants) > 0 {
+			cid := d.dict(descendants[0])
+			if dw, ok := number(d.resolve(cid["DW"])); ok {
+				x.missing = dw
+			}
+			x.cidWidths(d, d.array(cid["W"]))
+		}
+		return x
+	}
+	// simple fonts:
+	base, _ := d.resolve(f["BaseFont"]).(name)
+	x.encoding = standardEncoding()
+	if strings.Contains(string(base), "Symbol") || strings.Contains(string(base), "Dingbats") {
+		x.encoding = latin1Encoding()
+	}
+	switch e := d.resolve(f["Encoding"]).(type) {
+	case name:
+		x.encoding = namedEncoding(e, x.encoding)
+	case dict:
+		if b, ok := d.resolve(e["BaseEncoding"]).(name); ok {
+			x.encoding = namedEncoding(b, x.encoding)
+		}
+		code := 0
+		for _, v := range d.array(e["Differences"]) {
+			switch v := d.resolve(v).(type) {
+			case int:
+				code = v
+			case name:
+				if code >= 0 && code < 256 {
+					if text, ok := glyphText(string(v)); ok {
+						x.encoding[code] = text
+					}
+				}
+				code++
+			}
+		}
+	}
+	first, _ := d.resolve(f["FirstChar"]).(int)
+	for i, w := range d.array(f["Widths"]) {
+		x.widths[first+i] = d.number(w)
+	}
+	if fd := d.dict(f["FontDescriptor"]); fd != nil {
+		if mw, ok := number(d.resolve(fd["MissingWidth"])); ok && mw > 0 {
+			x.missing = mw
+		}
+	}
+	if len(x.widths) == 0 {
+		// probably one of the standard 14 fonts, so approximate their metrics:
+		for i, w := range helveticaWidths {
+			switch {
+			case strings.Contains(string(base), "Courier"):
+				x.widths[32+i] = 600
+			case strings.Contains(string(base), "Times"):
+				x.widths[32+i] = w * 0.9
+			default:
+				x.widths[32+i] = w
+			}
+		}
+	}
+	return x
+}
+
+// cidWidths reads a W array: "c [w1 w2 ...]" or "cfirst clast w"
+func (x *font) cidWidths(d *document, w array) {
+	for i := 0; i < len(w); {
+		first, ok := d.resolve(w[i]).(int)
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list, ok := d.resolve(w[i+1]).(array); ok {
+			for j, v := range list {
+				x.widths[first+j] = d.number(v)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, _ := d.resolve(w[i+1]).(int)
+		width := d.number(w[i+2])
+		for c := first; c <= last && c-first < 1<<16; c++ {
+			x.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+// decode splits a shown string into glyphs
+func (x *font) decode(s []byte) []glyph {
+	var out []glyph
+	for len(s) > 0 {
+		n := x.codeLength(s)
+		code := s[:n]
+		s = s[n:]
+		var c int
+		for _, b := range code {
+			c = c<<8 | int(b)
+		}
+		g := glyph{width: x.missing}
+		if w, ok := x.widths[c]; ok {
+			g.width = w
+		}
+		g.width *= x.scale
+		if text, ok := x.toUnicode[string(code)]; ok {
+			g.text = text
+		} else if !x.composite {
+			g.text = x.encoding[code[0]]
+		}
+		g.space = n == 1 && code[0] == ' '
+		out = append(out, g)
+	}
+	return out
+}
+
+func (x *font) codeLength(s []byte) int {
+	if !x.composite {
+		return 1
+	}
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, r := range x.codespace {
+			if len(r.lo) == n && inRange(s[:n], r) {
+				return n
+			}
+		}
+	}
+	return min(2, len(s))
+}
+
+func inRange(code []byte, r codeRange) bool {
+	for i, b := range code {
+		if b < r.lo[i] || b > r.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCMap reads the mappings and codespace of a ToUnicode cmap
+func parseCMap(data []byte) (map[string]string, []codeRange) {
+	out := make(map[string]string)
+	var space []codeRange
+	p := &parser{b: data}
+	var stack []any
+	for !p.eof() {
+		x, err := p.object()
+		if err != nil {
+			break
+		}
+		k, ok := x.(keyword)
+		if !ok {
+			stack = append(stack, x)
+			continue
+		}
+		switch k {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(stack); i += 2 {
+				lo, ok1 := stack[i].([]byte)
+				hi, ok2 := stack[i+1].([]byte)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					space = append(space, codeRange{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(stack); i += 2 {
+				if src, ok := stack[i].([]byte); ok {
+					if dst, ok := stack[i+1].([]byte); ok {
+						out[string(src)] = utf16Text(dst)
+					}
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(stack); i += 3 {
+				lo, ok1 := stack[i].([]byte)
+				hi, ok2 := stack[i+1].([]byte)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				bfrange(out, lo, hi, stack[i+2])
+			}
+		}
+		stack = stack[:0]
+	}
+	return out, space
+}
+
+func bfrange(out map[string]string, lo, hi []byte, dst any) {
+	start, end := 0, 0
+	for i := range lo {
+		start = start<<8 | int(lo[i])
+		end = end<<8 | int(hi[i])
+	}
+	for c := start; c <= end && c-start < 1<<16; c++ {
+		code := make([]byte, len(lo))
+		for i, v := len(code)-1, c; i >= 0; i, v = i-1, v>>8 {
+			code[i] = byte(v)
+		}
+		switch dst := dst.(type) {
+		case []byte:
+			if len(dst) == 0 {
+				continue
+			}
+			// increment the last byte of the destination:
+			next := append([]byte(nil), dst...)
+			next[len(next)-1] += byte(c - start)
+			out[string(code)] = utf16Text(next)
+		case array:
+			if i := c - start; i < len(dst) {
+				if s, ok := dst[i].([]byte); ok {
+					out[string(code)] = utf16Text(s)
+				}
+			}
+		}
+	}
+}
+
+func utf16Text(b []byte) string {
+	if len(b)%2 == 1 {
+		return string(latin1(b))
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(b []byte) []rune {
+	out := make([]rune, len(b))
+	for i, c := range b {
+		out[i] = rune(c)
+	}
+	return out
+}
+
+func latin1Encoding() [256]string {
+	var e [256]string
+	for i := 32; i < 256; i++ {
+		if i < 127 || i >= 160 {
+			e[i] = string(rune(i))
+		}
+	}
+	return e
+}
+
+func namedEncoding(n name, fallback [256]string) [256]string {
+	switch n {
+	case "WinAnsiEncoding":
+		e := latin1Encoding()
+		for i, r := range []rune(winAnsiHigh) {
+			if r >= 0x80 && r < 0xa0 {
+				continue // undefined
+			}
+			e[0x80+i] = string(r)
+		}
+		return e
+	case "MacRomanEncoding":
+		e := latin1Encoding()
+		for i, r := range []rune(macRomanHigh) {
+			e[0x80+i] = string(r)
+		}
+		return e
+	case "StandardEncoding":
+		return standardEncoding()
+	}
+	return fallback
+}
+
+func standardEncoding() [256]string {
+	var e [256]string
+	for i := 32; i < 127; i++ {
+		e[i] = string(rune(i))
+	}
+	e['\''] = "’"
+	e['`'] = "‘"
+	for code, glyph := range standardHigh {
+		e[code], _ = glyphText(glyph)
+	}
+	return e
+}
+
+// glyphText maps a glyph name to its text, per the adobe glyph list's conventions
+func glyphText(g string) (string, bool) {
+	if i := strings.IndexAny(g, "._"); i > 0 {
+		g = g[:i] // variants like "a.sc"
+	}
+	if t, ok := glyphNames[g]; ok {
+		return t, true
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		hex, ok := strings.CutPrefix(g, prefix)
+		if !ok || len(hex) < 4 {
+			continue
+		}
+		var r rune
+		valid := true
+		for _, c := range hex[:min(len(hex), 6)] {
+			switch {
+			case c >= '0' && c <= '9':
+				r = r<<4 | (c - '0')
+			case c >= 'A' && c <= 'F':
+				r = r<<4 | (c - 'A' + 10)
+			default:
+				valid = false
+			}
+		}
+		if valid {
+			return string(r), true
+		}
+	}
+	return "", false
+}
+
+var glyphNames = func() map[string]string {
+	m := make(map[string]string)
+	for i, n := range strings.Fields(asciiGlyphs) {
+		if n != "-" {
+			m[n] = string(rune(32 + i))
+		}
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		m[string(c)] = string(c)
+		m[string(c+'a'-'A')] = string(c + 'a' - 'A')
+	}
+	for i, n := range strings.Fields(latin1Glyphs) {
+		m[n] = string(rune(0xa0 + i))
+	}
+	for _, pair := range strings.Fields(otherGlyphs) {
+		n, t, _ := strings.Cut(pair, "=")
+		m[n] = t
+	}
+	return m
+}()
+
+// names of the non-letter ascii glyphs, from space on, with letters as "-"
+const asciiGlyphs = `space exclam quotedbl numbersign dollar percent ampersand quotesingle
+parenleft parenright asterisk plus comma hyphen period slash zero one two three four five six
+seven eight nine colon semicolon less equal greater question at
+- - - - - - - - - - - - - - - - - - - - - - - - - -
+bracketleft backslash bracketright asciicircum underscore grave
+- - - - - - - - - - - - - - - - - - - - - - - - - -
+braceleft bar braceright asciitilde`
+
+// names of the latin-1 glyphs from 0xa0
+const latin1Glyphs = `nbspace exclamdown cent sterling currency yen brokenbar section dieresis
+copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron degree plusminus
+twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine
+guillemotright onequarter onehalf threequarters questiondown Agrave Aacute Acircumflex Atilde
+Adieresis Aring AE Ccedilla Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex
+Idieresis Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute
+Ucircumflex Udieresis Yacute Thorn germandbls agrave aacute acircumflex atilde adieresis aring ae
+ccedilla egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis eth ntilde ograve
+oacute ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn
+ydieresis`
+
+const otherGlyphs = `quoteleft=‘ quoteright=’ quotedblleft=“ quotedblright=” quotesinglbase=‚
+quotedblbase=„ guilsinglleft=‹ guilsinglright=› endash=– emdash=— bullet=• ellipsis=… dagger=†
+daggerdbl=‡ perthousand=‰ trademark=™ fi=fi fl=fl ff=ff ffi=ffi ffl=ffl Euro=€ minus=− fraction=⁄
+OE=Œ oe=œ Scaron=Š scaron=š Zcaron=Ž zcaron=ž Ydieresis=Ÿ florin=ƒ circumflex=ˆ tilde=˜
+dotlessi=ı Lslash=Ł lslash=ł breve=˘ dotaccent=˙ ring=˚ hungarumlaut=˝ ogonek=˛ caron=ˇ`
+
+var standardHigh = map[int]string{
+	0xa1: "exclamdown", 0xa2: "cent", 0xa3: "sterling", 0xa4: "fraction", 0xa5: "yen", 0xa6: "florin",
+	0xa7: "section", 0xa8: "currency", 0xa9: "quotesingle", 0xaa: "quotedblleft", 0xab: "guillemotleft",
+	0xac: "guilsinglleft", 0xad: "guilsinglright", 0xae: "fi", 0xaf: "fl", 0xb1: "endash", 0xb2: "dagger",
+	0xb3: "daggerdbl", 0xb4: "periodcentered", 0xb6: "paragraph", 0xb7: "bullet", 0xb8: "quotesinglbase",
+	0xb9: "quotedblbase", 0xba: "quotedblright", 0xbb: "guillemotright", 0xbc: "ellipsis", 0xbd: "perthousand",
+	0xbf: "questiondown", 0xc1: "grave", 0xc2: "acute", 0xc3: "circumflex", 0xc4: "tilde", 0xc5: "macron",
+	0xc6: "breve", 0xc7: "dotaccent", 0xc8: "dieresis", 0xca: "ring", 0xcb: "cedilla", 0xcd: "hungarumlaut",
+	0xce: "ogonek", 0xcf: "caron", 0xd0: "emdash", 0xe1: "AE", 0xe3: "ordfeminine", 0xe8: "Lslash",
+	0xe9: "Oslash", 0xea: "OE", 0xeb: "ordmasculine", 0xf1: "ae", 0xf5: "dotlessi", 0xf8: "lslash",
+	0xf9: "oslash", 0xfa: "oe", 0xfb: "germandbls",
+}
+
+// 0x80 to 0x9f of WinAnsiEncoding, with undefined codes left as themselves
+const winAnsiHigh = "€\u0081‚ƒ„…†‡ˆ‰Š‹Œ\u008dŽ\u008f\u0090‘’“”•–—˜™š›œ\u009džŸ"
+
+// 0x80 to 0xff of MacRomanEncoding
+const macRomanHigh = "ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+	"¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ"
+
+// widths of helvetica's ascii glyphs from space, in thousandths of an em
+var helveticaWidths = []float64{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	222, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
@@ -0,0 +1,293 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// pdf objects are parsed into these types, alongside bool, int, float64 and nil
+type (
+	name    string
+	dict    map[name]any
+	array   []any
+	keyword string // an operator in a content stream, or a structural keyword
+	ref     struct{ num, gen int }
+	stream  struct {
+		dict dict
+		data []byte // still encoded
+	}
+)
+
+// parser reads pdf objects from a buffer
+type parser struct {
+	b   []byte
+	pos int
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool {
+	return !isSpace(c) && !isDelimiter(c)
+}
+
+// skipSpace skips whitespace and comments
+func (p *parser) skipSpace() {
+	for p.pos < len(p.b) {
+		switch c := p.b[p.pos]; {
+		case isSpace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) eof() bool {
+	p.skipSpace()
+	return p.pos >= len(p.b)
+}
+
+// regular reads a run of regular characters
+func (p *parser) regular() string {
+	start := p.pos
+	for p.pos < len(p.b) && isRegular(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// object reads the next object, or a keyword
+func (p *parser) object() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.b) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	switch c := p.b[p.pos]; {
+	case c == '/':
+		p.pos++
+		return name(unescapeName(p.regular())), nil
+	case c == '(':
+		return p.literal()
+	case c == '<' && p.pos+1 < len(p.b) && p.b[p.pos+1] == '<':
+		p.pos += 2
+		return p.dict()
+	case c == '<':
+		return p.hex()
+	case c == '[':
+		p.pos++
+		return p.array()
+	case c == ']', c == '>', c == ')', c == '{', c == '}':
+		p.pos++
+		return keyword(c), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	default:
+		word := p.regular()
+		if len(word) == 0 {
+			p.pos++
+			return keyword(c), nil
+		}
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return keyword(word), nil
+	}
+}
+
+func (p *parser) number() (any, error) {
+	word := p.regular()
+	if i, err := strconv.Atoi(word); err == nil {
+		// maybe a reference, "num gen R":
+		save := p.pos
+		p.skipSpace()
+		gen := p.regular()
+		p.skipSpace()
+		if g, err := strconv.Atoi(gen); err == nil && len(gen) > 0 && p.pos < len(p.b) && p.b[p.pos] == 'R' &&
+			(p.pos+1 == len(p.b) || !isRegular(p.b[p.pos+1])) {
+			p.pos++
+			return ref{i, g}, nil
+		}
+		p.pos = save
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		// tolerate junk like "--1" or "1.2.3", as readers do:
+		return 0.0, nil
+	}
+	return f, nil
+}
+
+func (p *parser) dict() (any, error) {
+	d := make(dict)
+	for {
+		p.skipSpace()
+		if p.pos+1 < len(p.b) && p.b[p.pos] == '>' && p.b[p.pos+1] == '>' {
+			p.pos += 2
+			return d, nil
+		}
+		k, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(name)
+		if !ok {
+			continue // skip junk
+		}
+		v, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		d[key] = v
+	}
+}
+
+func (p *parser) array() (any, error) {
+	var a array
+	for {
+		p.skipSpace()
+		if p.pos < len(p.b) && p.b[p.pos] == ']' {
+			p.pos++
+			return a, nil
+		}
+		x, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, x)
+	}
+}
+
+// literal reads a (string), with escapes and balanced parentheses
+func (p *parser) literal() (any, error) {
+	p.pos++
+	var out []byte
+	depth := 1
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, nil
+			}
+		case '\\':
+			if p.pos >= len(p.b) {
+				return out, nil
+			}
+			c = p.b[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+						n = n*8 + int(p.b[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(n)
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// hex reads a <hex string>
+func (p *parser) hex() (any, error) {
+	p.pos++
+	var digits []byte
+	for p.pos < len(p.b) && p.b[p.pos] != '>' {
+		if c := p.b[p.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		p.pos++
+	}
+	p.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad hex string")
+		}
+		out[i] = byte(v)
+	}
+	return out, nil
+}
+
+func unescapeName(s string) string {
+	if !bytes.ContainsRune([]byte(s), '#') {
+		return s
+	}
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// number converts a numeric object
+func number(x any) (float64, bool) {
+	switch x := x.(type) {
+	case int:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+// package pdf extracts text from pdf files, in pure go
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Page is the text of one page, numbered from 1
+type Page struct {
+	Number int
+	Text   string
+}
+
+// Version identifies the output of Extract, changing whenever it does, so
+// text cached from an older version isn't reused
+const Version = "1"
+
+// Extract returns the text of every page, lines ordered top to bottom and
+// left to right. it handles the common fonts, encodings and compression, but
+// not encryption or text drawn as images.
+func Extract(ctx context.Context, data []byte) (pages []Page, err error) {
+	// the parser reads untrusted files, so a bug must not crash the caller:
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("malformed pdf: %v", r)
+		}
+	}()
+	d, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	in := &interpreter{d: d, fonts: make(map[any]*font)}
+	var out []Page
+	for i, p := range d.pages() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		in.fragments = in.fragments[:0]
+		in.run(d.contents(p), p.resources, gstate{ctm: identity, scale: 1})
+		out = append(out, Page{Number: i + 1, Text: layout(in.fragments)})
+	}
+	return out, nil
+}
+
+// Pdftotext extracts pages with poppler's pdftotext binary, which must be installed
+func Pdftotext(ctx context.Context, data []byte) ([]Page, error) {
+	cmd := exec.CommandContext(ctx, "pdftotext", "-", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	buf, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftotext: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	// pages end with form feeds:
+	var out []Page
+	for i, text := range strings.Split(strings.TrimSuffix(string(buf), "\f"), "\f") {
+		out = append(out, Page{Number: i + 1, Text: strings.TrimSpace(text)})
+	}
+	return out, nil
+}
+
+// Text joins pages, each headed by its number so they can be cited
+func Text(pages []Page) string {
+	var out strings.Builder
+	for _, p := range pages {
+		fmt.Fprintf(&out, "[page %d]\n%s\n\n", p.Number, p.Text)
+	}
+	return out.String()
+}
@@ -0,0 +1,130 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// build writes objects, numbered from 1, with a classic xref and the catalog as root
+func build(objs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	var offs []int
+	for i, o := range objs {
+		offs = append(offs, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	x := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, o := range offs {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, x)
+	return b.Bytes()
+}
+
+func streamObj(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// onePage is a document of one page showing text, plus extra objects from number 6
+func onePage(text string, extra ...string) []byte {
+	return build(append([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		streamObj("", fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}, extra...)...)
+}
+
+func TestExtract(t *testing.T) {
+	pages, err := Extract(context.Background(), onePage("Hello, world!"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Number != 1 || !strings.Contains(pages[0].Text, "Hello, world!") {
+		t.Fatalf("got %+v", pages)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"negative first":       onePage("text", streamObj("/Type /ObjStm /N 1 /First -5", "9 0 << >>")),
+		"first past end":       onePage("text", streamObj("/Type /ObjStm /N 1 /First 500", "9 0 << >>")),
+		"negative offset":      onePage("text", streamObj("/Type /ObjStm /N 1 /First 6", "9 -3 << >>")),
+		"offset before stream": onePage("text", streamObj("/Type /ObjStm /N 1 /First 7", "9 -90 << >>")),
+		"offset past end":      onePage("text", streamObj("/Type /ObjStm /N 1 /First 6", "9 99 << >>")),
+		"too many objects":     onePage("text", streamObj("/Type /ObjStm /N 1000 /First 6", "9 0 << >>")),
+		"bad header":           onePage("text", streamObj("/Type /ObjStm /N 1 /First 6", "x y << >>")),
+		"bad filter data":      onePage("text", streamObj("/Type /ObjStm /N 1 /First 6 /Filter /FlateDecode", "garbage")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			pages, err := Extract(context.Background(), data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pages) != 1 || !strings.Contains(pages[0].Text, "text") {
+				t.Fatalf("got %+v", pages)
+			}
+		})
+	}
+}
+
+func TestUnreadable(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":      nil,
+		"not a pdf":  []byte("hello"),
+		"no catalog": []byte("%PDF-1.4\n1 0 obj\n<< /Type /Pages >>\nendobj\n"),
+		"truncated":  onePage("text")[:40],
+		"encrypted":  []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R /Encrypt 2 0 R >>\n"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Extract(context.Background(), data); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestBomb(t *testing.T) {
+	saved := maxStream
+	defer func() { maxStream = saved }()
+	maxStream = 1 << 20
+
+	var b bytes.Buffer
+	z := zlib.NewWriter(&b)
+	z.Write(make([]byte, 4<<20))
+	z.Close()
+	if _, err := inflate(b.Bytes()); err == nil {
+		t.Error("no error inflating past the limit")
+	}
+	if out, err := inflate(b.Bytes()[:200]); err != nil || len(out) > maxStream {
+		t.Errorf("truncated stream: %d bytes, %v", len(out), err)
+	}
+	if _, err := runLength(bytes.Repeat([]byte{129, 'x'}, 10000)); err == nil {
+		t.Error("no error decoding run lengths past the limit")
+	}
+
+	// a page whose content is a bomb has no text, but the rest is extracted:
+	data := build(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 6 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		streamObj("/Filter /FlateDecode", b.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		streamObj("", "BT /F1 12 Tf 72 720 Td (survivor) Tj ET"),
+	)
+	pages, err := Extract(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || len(pages[0].Text) > 0 || !strings.Contains(pages[1].Text, "survivor") {
+		t.Errorf("got %+v", pages)
+	}
+}
@@ -0,0 +1,267 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/client"
+	"xoba.com/llm/embedding"
+	"xoba.com/llm/vector"
+)
+
+// Retrieval injects only the passages of Files most relevant to the prompt,
+// rather than their whole text, for documents too large to paste
+type Retrieval struct {
+	ChunkSize    int    // in bytes; if zero, 2000
+	ChunkOverlap *int   // in bytes; if nil, 200
+	TopK         int    // passages to inject; if zero, 5
+	Index        *Index // reuse to keep embeddings across questions; if nil, one per question
+}
+
+// document is the text of a File, to be chunked
+type document struct {
+	Name string
+	Text string
+}
+
+// retrieve indexes the documents, returning a message with their passages most relevant to the prompt
+func (r Retrieval) retrieve(ctx context.Context, c client.Interface, prompt string, docs []document) (openai.ChatCompletionMessage, error) {
+	e, err := embedding.New(c, embedding.Config{})
+	if err != nil {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("retrieval: %w", err)
+	}
+	index := r.Index
+	if index == nil {
+		index = NewIndex()
+	}
+	size := r.ChunkSize
+	if size <= 0 {
+		size = 2000
+	}
+	overlap := 200
+	if r.ChunkOverlap != nil {
+		overlap = max(*r.ChunkOverlap, 0)
+	}
+	k := r.TopK
+	if k <= 0 {
+		k = 5
+	}
+	current := make(map[string]string) // document key to hash
+	for i, d := range docs {
+		key := documentKey(docs, i)
+		hash, err := index.Add(ctx, e, key, d.Text, size, overlap)
+		if err != nil {
+			return openai.ChatCompletionMessage{}, err
+		}
+		current[key] = hash
+	}
+	vectors, err := e.Embed(ctx, []string{prompt})
+	if err != nil {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("can't embed prompt: %w", err)
+	}
+	matches := index.Search(vectors[0], k, func(c Chunk) bool {
+		return current[c.File] == c.Hash
+	})
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "here are the %d passages of the files most relevant to the question, each cited by file name and byte offsets:\n\n", len(matches))
+	for _, m := range matches {
+		fmt.Fprintf(msg, "[%q, bytes %d-%d]\n%s\n\n", m.File, m.Start, m.End, strings.TrimSpace(m.Text))
+	}
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: msg.String(),
+	}, nil
+}
+
+// documentKey names the i'th document in the index and its citations: its
+// file name if that's unique among the documents, otherwise qualified by
+// its position, so documents never replace each other
+func documentKey(docs []document, i int) string {
+	name := docs[i].Name
+	if len(name) == 0 {
+		return fmt.Sprintf("unnamed file %d", i+1)
+	}
+	for j, d := range docs {
+		if j != i && d.Name == name {
+			return fmt.Sprintf("%s (file %d)", name, i+1)
+		}
+	}
+	return name
+}
+
+// Index is a vector index of file chunks, safe for concurrent use
+type Index struct {
+	store *vector.Store
+	mu    sync.Mutex
+	files map[string]*sync.Mutex // serializing Adds of each file
+}
+
+// Chunk is a piece of a file's text
+type Chunk struct {
+	File  string
+	Hash  string // of the file's whole text, so unchanged files aren't re-embedded
+	Start int    // byte offset of the chunk in the file's text
+	End   int
+	Text  string
+}
+
+// Match is a chunk found by Search
+type Match struct {
+	Chunk
+	Score float64 // cosine similarity to the query
+}
+
+func NewIndex() *Index {
+	return &Index{store: vector.NewStore(vector.Cosine)}
+}
+
+// LoadIndex reads an index written by Save
+func LoadIndex(path string) (*Index, error) {
+	s, err := vector.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{store: s}, nil
+}
+
+// Save writes the index to a file, atomically
+func (x *Index) Save(path string) error {
+	return x.store.Save(path)
+}
+
+// Len is the number of chunks indexed
+func (x *Index) Len() int {
+	return x.store.Len()
+}
+
+// Add chunks and embeds a file's text, replacing any earlier version of
+// the file, and returns the hash identifying this version. concurrent Adds
+// of a file take turns, so the same version is embedded once, but the last
+// version added wins.
+func (x *Index) Add(ctx context.Context, e client.Embedder, name, text string, size, overlap int) (string, error) {
+	defer x.lock(name)()
+	sum := sha256.Sum256([]byte(text))
+	hash := hex.EncodeToString(sum[:])
+	version := vector.All(vector.Match("file", name), vector.Match("hash", hash))
+	if len(x.store.Items(version)) > 0 {
+		return hash, nil
+	}
+	var texts []string
+	spans := split(text, size, overlap)
+	for _, s := range spans {
+		texts = append(texts, text[s[0]:s[1]])
+	}
+	vectors, err := e.Embed(ctx, texts)
+	if err != nil {
+		return "", fmt.Errorf("can't embed %q: %w", name, err)
+	}
+	var items []vector.Item
+	for i, s := range spans {
+		items = append(items, vector.Item{
+			ID:     fmt.Sprintf("%s@%s:%d", name, hash, s[0]),
+			Vector: vectors[i],
+			Metadata: map[string]string{
+				"file":  name,
+				"hash":  hash,
+				"start": strconv.Itoa(s[0]),
+				"end":   strconv.Itoa(s[1]),
+				"text":  texts[i],
+			},
+		})
+	}
+	x.store.Replace(vector.Match("file", name), items...)
+	return hash, nil
+}
+
+// lock serializes Adds of the named file, returning the unlock
+func (x *Index) lock(name string) func() {
+	x.mu.Lock()
+	if x.files == nil {
+		x.files = make(map[string]*sync.Mutex)
+	}
+	m, ok := x.files[name]
+	if !ok {
+		m = new(sync.Mutex)
+		x.files[name] = m
+	}
+	x.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+// Search returns the k chunks most similar to the vector, among those accepted by the filter, if any
+func (x *Index) Search(v []float32, k int, filter func(Chunk) bool) []Match {
+	var f vector.Filter
+	if filter != nil {
+		f = func(i vector.Item) bool {
+			return filter(chunk(i))
+		}
+	}
+	var out []Match
+	for _, r := range x.store.Search(v, k, f) {
+		out = append(out, Match{Chunk: chunk(r.Item), Score: r.Score})
+	}
+	return out
+}
+
+func chunk(i vector.Item) Chunk {
+	start, _ := strconv.Atoi(i.Metadata["start"])
+	end, _ := strconv.Atoi(i.Metadata["end"])
+	return Chunk{
+		File:  i.Metadata["file"],
+		Hash:  i.Metadata["hash"],
+		Start: start,
+		End:   end,
+		Text:  i.Metadata["text"],
+	}
+}
+
+// split divides text into spans of about size bytes overlapping by about
+// overlap, breaking at paragraphs, lines or words where possible
+func split(text string, size, overlap int) [][2]int {
+	var out [][2]int
+	for start := 0; start < len(text); {
+		end := min(start+size, len(text))
+		if end < len(text) {
+			end = boundary(text, start+size/2, end)
+		}
+		out = append(out, [2]int{start, end})
+		if end == len(text) {
+			break
+		}
+		next := max(end-overlap, start+1)
+		// start at a line, or at least a word:
+		if i := strings.IndexByte(text[next:end], '\n'); i >= 0 {
+			next += i + 1
+		} else if i := strings.IndexAny(text[next:end], " \t"); i >= 0 {
+			next += i + 1
+		}
+		for next < len(text) && !utf8.RuneStart(text[next]) {
+			next++
+		}
+		start = next
+	}
+	return out
+}
+
+// boundary is the best place to break text within [lo, hi]: after a
+// paragraph, line or word, or else at a rune boundary
+func boundary(text string, lo, hi int) int {
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		if i := strings.LastIndex(text[lo:hi], sep); i >= 0 {
+			return lo + i + len(sep)
+		}
+	}
+	for hi > lo && !utf8.RuneStart(text[hi]) {
+		hi--
+	}
+	return hi
+}
@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xoba.com/llm/client"
+	"xoba.com/llm/client/fake"
+)
+
+// countingEmbedder embeds texts by their length, counting its calls
+type countingEmbedder struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.calls++
+	e.mu.Unlock()
+	time.Sleep(10 * time.Millisecond) // as if calling an api, so Adds overlap
+	var out [][]float32
+	for _, t := range texts {
+		out = append(out, []float32{float32(len(t)), 1})
+	}
+	return out, nil
+}
+
+func TestIndexConcurrentAdd(t *testing.T) {
+	x := NewIndex()
+	e := new(countingEmbedder)
+	text := strings.Repeat("all work and no play. ", 50)
+	var wg sync.WaitGroup
+	hashes := make([]string, 8)
+	for i := range hashes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h, err := x.Add(context.Background(), e, "a.txt", text, 300, 30)
+			if err != nil {
+				t.Error(err)
+			}
+			hashes[i] = h
+		}()
+	}
+	wg.Wait()
+	if e.calls != 1 {
+		t.Errorf("embedded %d times", e.calls)
+	}
+	spans := len(split(text, 300, 30))
+	if x.Len() != spans {
+		t.Errorf("%d chunks, want %d", x.Len(), spans)
+	}
+	for _, h := range hashes {
+		if h != hashes[0] {
+			t.Errorf("hashes %v", hashes)
+			break
+		}
+	}
+	// a new version replaces the old:
+	h, err := x.Add(context.Background(), e, "a.txt", "short now", 300, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := x.Search([]float32{1, 1}, 10, nil)
+	if len(matches) != 1 || matches[0].Hash != h || matches[0].Text != "short now" {
+		t.Errorf("got %+v", matches)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	text := strings.Repeat("word ", 200)
+	for _, overlap := range []int{0, 50} {
+		spans := split(text, 100, overlap)
+		if spans[0][0] != 0 || spans[len(spans)-1][1] != len(text) {
+			t.Errorf("overlap %d: spans %v don't cover the text", overlap, spans)
+		}
+		for i := 1; i < len(spans); i++ {
+			gap := spans[i-1][1] - spans[i][0]
+			if overlap == 0 && gap != 0 || overlap > 0 && (gap <= 0 || gap > overlap) {
+				t.Errorf("overlap %d: spans %v and %v", overlap, spans[i-1], spans[i])
+			}
+		}
+	}
+}
+
+func TestRetrieveSameNames(t *testing.T) {
+	s := fake.OpenAI()
+	defer s.Close()
+	c, err := client.NewFromConfig(client.Config{Provider: client.OpenAIProvider, Key: "test", BaseURL: s.BaseURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []document{
+		{Name: "", Text: "apples grow on trees"},
+		{Name: "", Text: "bananas grow in bunches"},
+		{Name: "notes.txt", Text: "cherries are red"},
+		{Name: "notes.txt", Text: "dates are sweet"},
+		{Name: "other.txt", Text: "elderberries are dark"},
+	}
+	index := NewIndex()
+	m, err := Retrieval{TopK: 10, Index: index}.retrieve(context.Background(), c, "fruit", docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every document is retrievable, cited apart from its namesakes:
+	for _, want := range []string{
+		`["unnamed file 1", bytes 0-20]` + "\napples",
+		`["unnamed file 2", bytes 0-23]` + "\nbananas",
+		`["notes.txt (file 3)", bytes 0-16]` + "\ncherries",
+		`["notes.txt (file 4)", bytes 0-15]` + "\ndates",
+		`["other.txt", bytes 0-21]` + "\nelderberries",
+	} {
+		if !strings.Contains(m.Content, want) {
+			t.Errorf("missing %q in:\n%s", want, m.Content)
+		}
+	}
+	if index.Len() != len(docs) {
+		t.Errorf("%d chunks indexed, want %d", index.Len(), len(docs))
+	}
+}
@@ -1,9 +1,20 @@
 package schema
 
-import "github.com/invopop/jsonschema"
+import (
+	"reflect"
 
+	"github.com/invopop/jsonschema"
+)
+
+// Calculate reflects the json schema of a's type. named structs are expanded
+// in place rather than referenced; the reflector can't expand other types,
+// and reflects anonymous structs in place anyway.
 func Calculate(a any) *jsonschema.Schema {
 	r := new(jsonschema.Reflector)
-	r.ExpandedStruct = true
+	t := reflect.TypeOf(a)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	r.ExpandedStruct = t != nil && t.Kind() == reflect.Struct && len(t.Name()) > 0
 	return r.Reflect(a)
 }
@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"fmt"
+
+	"github.com/invopop/jsonschema"
+)
+
+// Strict modifies s in place to satisfy the constraints of openai's strict
+// structured outputs: every property required, optional ones made nullable,
+// no additional properties, and no unsupported keywords. it returns an error
+// for constructs strict mode can't express, like maps and untyped values.
+func Strict(s *jsonschema.Schema) (*jsonschema.Schema, error) {
+	s.Version = ""
+	s.ID = ""
+	if err := strict(s, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func strict(s *jsonschema.Schema, path string) error {
+	if s == nil {
+		return nil
+	}
+	if s == jsonschema.TrueSchema || s == jsonschema.FalseSchema {
+		return fmt.Errorf("%s: untyped values not supported", path)
+	}
+	if len(s.Type) == 0 && len(s.Ref) == 0 && len(s.AnyOf) == 0 && len(s.Enum) == 0 && s.Const == nil && s.Properties == nil {
+		return fmt.Errorf("%s: untyped values not supported", path)
+	}
+	if len(s.AllOf) > 0 || len(s.OneOf) > 0 || s.Not != nil || s.If != nil || len(s.PatternProperties) > 0 {
+		return fmt.Errorf("%s: allOf, oneOf, not, if and patternProperties not supported", path)
+	}
+	// keywords strict mode rejects:
+	s.Anchor, s.Comments = "", ""
+	s.MultipleOf, s.Maximum, s.ExclusiveMaximum, s.Minimum, s.ExclusiveMinimum = "", "", "", "", ""
+	s.MaxLength, s.MinLength, s.Pattern, s.Format = nil, nil, "", ""
+	s.MaxItems, s.MinItems, s.UniqueItems, s.MaxContains, s.MinContains = nil, nil, false, nil, nil
+	s.MaxProperties, s.MinProperties, s.DependentRequired, s.DependentSchemas = nil, nil, nil, nil
+	s.PropertyNames, s.Contains, s.PrefixItems = nil, nil, nil
+	s.ContentEncoding, s.ContentMediaType, s.ContentSchema = "", "", nil
+	s.Default, s.Examples, s.Deprecated, s.ReadOnly, s.WriteOnly = nil, nil, false, false, false
+
+	for name, d := range s.Definitions {
+		if err := strict(d, path+"/$defs/"+name); err != nil {
+			return err
+		}
+	}
+	for i, x := range s.AnyOf {
+		if err := strict(x, fmt.Sprintf("%s/anyOf/%d", path, i)); err != nil {
+			return err
+		}
+	}
+	if err := strict(s.Items, path+"/items"); err != nil {
+		return err
+	}
+	if s.Type != "object" && s.Properties == nil {
+		return nil
+	}
+	if ap := s.AdditionalProperties; ap != nil && ap != jsonschema.FalseSchema {
+		return fmt.Errorf("%s: maps not supported", path)
+	}
+	s.AdditionalProperties = jsonschema.FalseSchema
+	if s.Properties == nil {
+		s.Properties = jsonschema.NewProperties()
+	}
+	required := make(map[string]bool)
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	s.Required = nil
+	for p := s.Properties.Oldest(); p != nil; p = p.Next() {
+		if err := strict(p.Value, path+"/properties/"+p.Key); err != nil {
+			return err
+		}
+		if !required[p.Key] {
+			p.Value = &jsonschema.Schema{
+				AnyOf: []*jsonschema.Schema{p.Value, {Type: "null"}},
+			}
+		}
+		s.Required = append(s.Required, p.Key)
+	}
+	return nil
+}
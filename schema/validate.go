@@ -0,0 +1,338 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/invopop/jsonschema"
+)
+
+// ValidationError lists every way a value violates a schema
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Violations, "; ")
+}
+
+// Validate checks a json document against the schema, covering the keywords
+// the reflector emits: types, enums, consts, required and additional properties,
+// items, sizes, patterns, numeric bounds, anyOf/oneOf/allOf/not and local $refs.
+// formats are only annotations, so ignored.
+func Validate(s *jsonschema.Schema, doc []byte) error {
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	return ValidateValue(s, v)
+}
+
+// ValidateValue is like Validate, for a value already decoded into generic
+// json types, with numbers as json.Number or float64
+func ValidateValue(s *jsonschema.Schema, v any) error {
+	x := validator{root: s}
+	x.validate(s, v, "")
+	if len(x.violations) > 0 {
+		return &ValidationError{Violations: x.violations}
+	}
+	return nil
+}
+
+type validator struct {
+	root       *jsonschema.Schema
+	violations []string
+	depth      int // of $ref resolution, to stop runaway recursion
+}
+
+func (x *validator) fail(path, format string, args ...any) {
+	if len(path) == 0 {
+		path = "value"
+	}
+	x.violations = append(x.violations, path+": "+fmt.Sprintf(format, args...))
+}
+
+// valid reports whether v satisfies s, without recording violations
+func (x *validator) valid(s *jsonschema.Schema, v any) bool {
+	y := validator{root: x.root, depth: x.depth}
+	y.validate(s, v, "")
+	return len(y.violations) == 0
+}
+
+func (x *validator) validate(s *jsonschema.Schema, v any, path string) {
+	switch {
+	case s == nil || s == jsonschema.TrueSchema:
+		return
+	case s == jsonschema.FalseSchema:
+		x.fail(path, "no value allowed")
+		return
+	}
+	if len(s.Ref) > 0 {
+		ref, err := x.resolve(s.Ref)
+		if err != nil {
+			x.fail(path, "%v", err)
+			return
+		}
+		if x.depth > 100 {
+			x.fail(path, "schema references nested too deeply")
+			return
+		}
+		x.depth++
+		x.validate(ref, v, path)
+		x.depth--
+	}
+	if len(s.Type) > 0 && !hasType(s.Type, v) {
+		x.fail(path, "expected %s, got %s", s.Type, typeOf(v))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, v) }) {
+		x.fail(path, "%s is not one of %s", show(v), show(s.Enum))
+	}
+	if s.Const != nil && !equal(s.Const, v) {
+		x.fail(path, "%s is not %s", show(v), show(s.Const))
+	}
+	for _, sub := range s.AllOf {
+		x.validate(sub, v, path)
+	}
+	if len(s.AnyOf) > 0 && !slices.ContainsFunc(s.AnyOf, func(sub *jsonschema.Schema) bool { return x.valid(sub, v) }) {
+		x.fail(path, "%s matches none of the allowed schemas", show(v))
+	}
+	if len(s.OneOf) > 0 {
+		var n int
+		for _, sub := range s.OneOf {
+			if x.valid(sub, v) {
+				n++
+			}
+		}
+		if n != 1 {
+			x.fail(path, "%s matches %d schemas instead of exactly one", show(v), n)
+		}
+	}
+	if s.Not != nil && x.valid(s.Not, v) {
+		x.fail(path, "%s matches a disallowed schema", show(v))
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		x.object(s, v, path)
+	case []any:
+		x.array(s, v, path)
+	case string:
+		x.string(s, v, path)
+	case json.Number, float64:
+		x.number(s, toFloat(v), path)
+	}
+}
+
+func (x *validator) object(s *jsonschema.Schema, v map[string]any, path string) {
+	for _, r := range s.Required {
+		if _, ok := v[r]; !ok {
+			x.fail(join(path, r), "missing required field")
+		}
+	}
+	if s.MinProperties != nil && uint64(len(v)) < *s.MinProperties {
+		x.fail(path, "fewer than %d fields", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && uint64(len(v)) > *s.MaxProperties {
+		x.fail(path, "more than %d fields", *s.MaxProperties)
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys) // for stable messages
+	for _, k := range keys {
+		if s.Properties != nil {
+			if sub, ok := s.Properties.Get(k); ok {
+				x.validate(sub, v[k], join(path, k))
+				continue
+			}
+		}
+		matched := false
+		for pattern, sub := range s.PatternProperties {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(k) {
+				matched = true
+				x.validate(sub, v[k], join(path, k))
+			}
+		}
+		if matched {
+			continue
+		}
+		switch ap := s.AdditionalProperties; {
+		case ap == nil:
+		case ap == jsonschema.FalseSchema:
+			x.fail(join(path, k), "unknown field")
+		default:
+			x.validate(ap, v[k], join(path, k))
+		}
+	}
+}
+
+func (x *validator) array(s *jsonschema.Schema, v []any, path string) {
+	if s.MinItems != nil && uint64(len(v)) < *s.MinItems {
+		x.fail(path, "fewer than %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && uint64(len(v)) > *s.MaxItems {
+		x.fail(path, "more than %d items", *s.MaxItems)
+	}
+	if s.UniqueItems {
+		for i := range v {
+			for j := range i {
+				if equal(v[i], v[j]) {
+					x.fail(path, "items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+	for i, item := range v {
+		sub := s.Items
+		if i < len(s.PrefixItems) {
+			sub = s.PrefixItems[i]
+		}
+		x.validate(sub, item, fmt.Sprintf("%s[%d]", path, i))
+	}
+}
+
+func (x *validator) string(s *jsonschema.Schema, v string, path string) {
+	n := uint64(utf8.RuneCountInString(v))
+	if s.MinLength != nil && n < *s.MinLength {
+		x.fail(path, "shorter than %d characters", *s.MinLength)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		x.fail(path, "longer than %d characters", *s.MaxLength)
+	}
+	if len(s.Pattern) > 0 {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			x.fail(path, "bad pattern %q: %v", s.Pattern, err)
+		} else if !re.MatchString(v) {
+			x.fail(path, "%q does not match %q", v, s.Pattern)
+		}
+	}
+}
+
+func (x *validator) number(s *jsonschema.Schema, v float64, path string) {
+	bound := func(n json.Number, violated func(b float64) bool, format string) {
+		if len(n) == 0 {
+			return
+		}
+		if b, err := n.Float64(); err == nil && violated(b) {
+			x.fail(path, format, v, b)
+		}
+	}
+	bound(s.Minimum, func(b float64) bool { return v < b }, "%v is less than %v")
+	bound(s.Maximum, func(b float64) bool { return v > b }, "%v is greater than %v")
+	bound(s.ExclusiveMinimum, func(b float64) bool { return v <= b }, "%v is not greater than %v")
+	bound(s.ExclusiveMaximum, func(b float64) bool { return v >= b }, "%v is not less than %v")
+	bound(s.MultipleOf, func(b float64) bool {
+		q := v / b
+		return b != 0 && math.Abs(q-math.Round(q)) > 1e-9
+	}, "%v is not a multiple of %v")
+}
+
+// resolve finds a local reference like "#/$defs/Name"
+func (x *validator) resolve(ref string) (*jsonschema.Schema, error) {
+	if ref == "#" {
+		return x.root, nil
+	}
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+	d, ok := x.root.Definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reference %q", ref)
+	}
+	return d, nil
+}
+
+func hasType(t string, v any) bool {
+	switch t {
+	case "integer":
+		f := toFloat(v)
+		return typeOf(v) == "number" && f == math.Trunc(f)
+	case "number":
+		return typeOf(v) == "number"
+	default:
+		return typeOf(v) == t
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number, float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+// equal compares json values, treating numbers by value
+func equal(a, b any) bool {
+	return show(normalize(a)) == show(normalize(b))
+}
+
+func normalize(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		return toFloat(v)
+	case int:
+		return float64(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, x := range v {
+			out[i] = normalize(x)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[k] = normalize(x)
+		}
+		return out
+	}
+	return v
+}
+
+func show(v any) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
+
+func join(path, field string) string {
+	if len(path) == 0 {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,243 @@
+// package sniff detects the content types of files, from their content and
+// names, for callers who don't know them
+package sniff
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Generic reports whether a content type says nothing about the content
+func Generic(contentType string) bool {
+	switch Normalize(contentType) {
+	case "", "application/octet-stream", "binary/octet-stream", "application/unknown", "application/binary":
+		return true
+	}
+	return false
+}
+
+// aliases are non-standard content types, by their standard ones
+var aliases = map[string]string{
+	"image/jpg":                    "image/jpeg",
+	"image/pjpeg":                  "image/jpeg",
+	"audio/mp3":                    "audio/mpeg",
+	"audio/mpeg3":                  "audio/mpeg",
+	"audio/x-mp3":                  "audio/mpeg",
+	"audio/x-mpeg":                 "audio/mpeg",
+	"audio/mpga":                   "audio/mpeg",
+	"audio/x-wav":                  "audio/wav",
+	"audio/wave":                   "audio/wav",
+	"audio/vnd.wave":               "audio/wav",
+	"audio/m4a":                    "audio/mp4",
+	"audio/x-m4a":                  "audio/mp4",
+	"application/x-pdf":            "application/pdf",
+	"application/x-gzip":           "application/gzip",
+	"application/x-zip":            "application/zip",
+	"application/x-zip-compressed": "application/zip",
+	"application/x-json":           "application/json",
+	"text/json":                    "application/json",
+	"text/x-markdown":              "text/markdown",
+	"text/x-yaml":                  "text/yaml",
+	"application/x-yaml":           "text/yaml",
+	"application/yaml":             "text/yaml",
+	"application/xml":              "text/xml",
+	"application/csv":              "text/csv",
+	"application/rtf":              "text/rtf",
+	"application/xhtml+xml":        "text/html",
+}
+
+// Normalize lowercases a content type, drops its parameters, and replaces aliases
+func Normalize(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t, _, _ = strings.Cut(contentType, ";")
+		t = strings.ToLower(strings.TrimSpace(t))
+	}
+	if a, ok := aliases[t]; ok {
+		return a
+	}
+	return t
+}
+
+// extensions maps file name extensions to content types, rather than the
+// system's mime tables, so detection doesn't vary by machine
+var extensions = map[string]string{
+	".pdf":      "application/pdf",
+	".txt":      "text/plain",
+	".text":     "text/plain",
+	".log":      "text/plain",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".csv":      "text/csv",
+	".tsv":      "text/tab-separated-values",
+	".json":     "application/json",
+	".yaml":     "text/yaml",
+	".yml":      "text/yaml",
+	".xml":      "text/xml",
+	".html":     "text/html",
+	".htm":      "text/html",
+	".rtf":      "text/rtf",
+	".rst":      "text/x-rst",
+	".org":      "text/x-org",
+	".png":      "image/png",
+	".jpg":      "image/jpeg",
+	".jpeg":     "image/jpeg",
+	".gif":      "image/gif",
+	".webp":     "image/webp",
+	".mp3":      "audio/mpeg",
+	".mpga":     "audio/mpeg",
+	".m4a":      "audio/mp4",
+	".wav":      "audio/wav",
+	".mp4":      "video/mp4",
+	".mpeg":     "video/mpeg",
+	".mpg":      "video/mpeg",
+	".webm":     "video/webm",
+	".docx":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx":     "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx":     "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":      "application/vnd.oasis.opendocument.text",
+	".zip":      "application/zip",
+	".gz":       "application/gzip",
+	".tgz":      "application/gzip",
+	".tar":      "application/x-tar",
+}
+
+// ByName returns the content type implied by a file name's extension, if any
+func ByName(name string) string {
+	return extensions[strings.ToLower(path.Ext(name))]
+}
+
+// Detect returns the content type of a file: by its signature if it has
+// one, else by its name's extension, else by whether it's text
+func Detect(name string, content []byte) string {
+	if t := Magic(content); len(t) > 0 {
+		return t
+	}
+	byName := ByName(name)
+	if Text(byName) && (utf8.Valid(content) && !bytes.ContainsRune(content, 0) || bom(content)) {
+		return byName
+	}
+	t := Normalize(http.DetectContentType(content))
+	switch {
+	case t == "text/plain":
+		if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+			return "application/json"
+		}
+	case Generic(t) && len(byName) > 0:
+		return byName
+	}
+	return t
+}
+
+// Text reports whether a content type is of text
+func Text(contentType string) bool {
+	t := Normalize(contentType)
+	return strings.HasPrefix(t, "text/") || t == "application/json"
+}
+
+// bom reports whether content starts with a unicode byte order mark
+func bom(content []byte) bool {
+	return bytes.HasPrefix(content, []byte("\xef\xbb\xbf")) || bytes.HasPrefix(content, []byte("\xff\xfe")) || bytes.HasPrefix(content, []byte("\xfe\xff"))
+}
+
+// Magic returns the content type of a file by its signature, or "" if it has
+// no signature recognized. zip files are inspected for office documents.
+func Magic(content []byte) string {
+	has := func(offset int, sig string) bool {
+		return len(content) >= offset+len(sig) && string(content[offset:offset+len(sig)]) == sig
+	}
+	switch {
+	case has(0, "%PDF-"):
+		return "application/pdf"
+	case bytes.Contains(content[:min(len(content), 1024)], []byte("%PDF-")) && !utf8.Valid(content[:min(len(content), 4096)]):
+		return "application/pdf" // after some junk, which readers allow; text merely mentioning pdf's is valid utf-8
+	case has(0, "\x89PNG\r\n\x1a\n"):
+		return "image/png"
+	case has(0, "\xff\xd8\xff"):
+		return "image/jpeg"
+	case has(0, "GIF87a"), has(0, "GIF89a"):
+		return "image/gif"
+	case has(0, "RIFF") && has(8, "WEBP"):
+		return "image/webp"
+	case has(0, "RIFF") && has(8, "WAVE"):
+		return "audio/wav"
+	case has(0, "ID3") && len(content) >= 5 && content[3] >= 2 && content[3] <= 4 && content[4] == 0:
+		return "audio/mpeg"
+	case mpegFrame(content):
+		return "audio/mpeg"
+	case has(4, "ftyp"):
+		switch {
+		case has(8, "M4A "), has(8, "M4B "), has(8, "F4A "):
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	case has(0, "\x1a\x45\xdf\xa3"):
+		return "video/webm"
+	case has(0, "\x00\x00\x01\xba"), has(0, "\x00\x00\x01\xb3"):
+		return "video/mpeg"
+	case has(0, "OggS"):
+		return "audio/ogg"
+	case has(0, "fLaC"):
+		return "audio/flac"
+	case has(0, "PK\x03\x04"), has(0, "PK\x05\x06"):
+		return container(content)
+	case has(0, "\x1f\x8b"):
+		return "application/gzip"
+	case has(257, "ustar"):
+		return "application/x-tar"
+	}
+	return ""
+}
+
+// mpegFrame reports whether content starts with a valid mpeg audio frame
+// header, as mp3's without id3 tags do. utf-16 text starts with ff fe, which
+// would otherwise pass.
+func mpegFrame(content []byte) bool {
+	if len(content) < 4 || content[0] != 0xff || content[1]&0xe0 != 0xe0 || bom(content) {
+		return false
+	}
+	version := content[1] >> 3 & 3 // 1 is reserved
+	layer := content[1] >> 1 & 3   // 0 is reserved
+	bitrate := content[2] >> 4     // 0 is free format, which nobody uses, and 15 is bad
+	rate := content[2] >> 2 & 3    // 3 is reserved
+	return version != 1 && layer != 0 && bitrate != 0 && bitrate != 15 && rate != 3
+}
+
+// container tells office documents from other zip files
+func container(content []byte) string {
+	z, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "application/zip"
+	}
+	names := make(map[string]*zip.File)
+	for _, f := range z.File {
+		names[f.Name] = f
+	}
+	switch {
+	case names["word/document.xml"] != nil:
+		return extensions[".docx"]
+	case names["xl/workbook.xml"] != nil:
+		return extensions[".xlsx"]
+	case names["ppt/presentation.xml"] != nil:
+		return extensions[".pptx"]
+	}
+	// opendocument files name their type in a first, uncompressed entry:
+	if f := names["mimetype"]; f != nil && f.UncompressedSize64 < 256 {
+		if r, err := f.Open(); err == nil {
+			defer r.Close()
+			if b, err := io.ReadAll(r); err == nil {
+				if t := strings.TrimSpace(string(b)); strings.HasPrefix(t, "application/vnd.oasis.opendocument.") {
+					return t
+				}
+			}
+		}
+	}
+	return "application/zip"
+}
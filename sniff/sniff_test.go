@@ -0,0 +1,73 @@
+package sniff
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+// utf16le encodes text as utf-16 little-endian, with a byte order mark
+func utf16le(text string) []byte {
+	out := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(text)) {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
+
+func TestDetect(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"a.pdf", []byte("%PDF-1.4\n"), "application/pdf"},
+		{"x", []byte("\x89PNG\r\n\x1a\n...."), "image/png"},
+		{"x", []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), "audio/mpeg"},
+		{"x", []byte("\xff\xfb\x90\x64\x00\x00"), "audio/mpeg"}, // mpeg 1 layer iii, 128kbps, 44.1kHz
+		{"x.csv", utf16le("a,b\n1,2\n"), "text/csv"},
+		{"x.txt", utf16le("hello"), "text/plain"},
+		{"x", utf16le("hello"), "text/plain"},
+		{"ID3.txt", []byte("ID3 tags are metadata"), "text/plain"},
+		{"notes.md", []byte("# title"), "text/markdown"},
+		{"x", []byte(`{"a": 1}`), "application/json"},
+		{"song.mp3", []byte{0, 1, 2, 3}, "audio/mpeg"},
+	} {
+		if got := Detect(c.name, c.content); got != c.want {
+			t.Errorf("Detect(%q, % x) = %q, want %q", c.name, c.content[:min(len(c.content), 8)], got, c.want)
+		}
+	}
+}
+
+func TestMpegFrame(t *testing.T) {
+	for _, c := range []struct {
+		header []byte
+		want   bool
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x64}, true},  // mpeg 1 layer iii
+		{[]byte{0xff, 0xf3, 0x48, 0xc4}, true},  // mpeg 2 layer iii
+		{[]byte{0xff, 0xfe, 0x61, 0x00}, false}, // utf-16le byte order mark
+		{[]byte{0xff, 0xeb, 0x90, 0x64}, false}, // reserved version
+		{[]byte{0xff, 0xf9, 0x90, 0x64}, false}, // reserved layer
+		{[]byte{0xff, 0xfb, 0x00, 0x64}, false}, // free bitrate
+		{[]byte{0xff, 0xfb, 0xf0, 0x64}, false}, // bad bitrate
+		{[]byte{0xff, 0xfb, 0x9c, 0x64}, false}, // reserved sample rate
+		{[]byte{0xff, 0xfb}, false},             // too short
+	} {
+		if got := mpegFrame(c.header); got != c.want {
+			t.Errorf("mpegFrame(% x) = %v, want %v", c.header, got, c.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"image/jpg":                 "image/jpeg",
+		"Audio/MP3":                 "audio/mpeg",
+		"text/plain; charset=utf-8": "text/plain",
+		"":                          "",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/schema"
+)
+
+// NewTool makes a Tool of a function, deriving its parameter schema from
+// the In type, strictly decoding arguments into In, and marshalling each Out
+// result as json. it panics if In has no json schema, as when it is or
+// holds a channel or function.
+func NewTool[In, Out any](name, description string, f func(context.Context, In) (Out, error)) ContextTool {
+	return &tool[In, Out]{
+		name:        name,
+		description: description,
+		params:      parameters[In](name),
+		f:           f,
+	}
+}
+
+// parameters calculates the schema of In, once per tool
+func parameters[In any](name string) *jsonschema.Schema {
+	var in In
+	defer func() {
+		if r := recover(); r != nil {
+			panic(fmt.Sprintf("tool %q: no json schema for %v: %v", name, reflect.TypeFor[In](), r))
+		}
+	}()
+	return schema.Calculate(in)
+}
+
+type tool[In, Out any] struct {
+	name, description string
+	params            *jsonschema.Schema
+	f                 func(context.Context, In) (Out, error)
+}
+
+func (t *tool[In, Out]) Defintion() openai.FunctionDefinition {
+	return openai.FunctionDefinition{
+		Name:        t.name,
+		Description: t.description,
+		Parameters:  t.params,
+	}
+}
+
+func (t *tool[In, Out]) Compute(parameters string) (string, error) {
+	return t.ComputeContext(context.Background(), parameters)
+}
+
+func (t *tool[In, Out]) ComputeContext(ctx context.Context, parameters string) (string, error) {
+	in, err := t.decode(parameters)
+	if err != nil {
+		return "", err
+	}
+	out, err := t.f(ctx, in)
+	if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(out)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// decode admits exactly one json value, satisfying the schema of In
+func (t *tool[In, Out]) decode(parameters string) (In, error) {
+	var in In
+	invalid := func(err error) (In, error) {
+		return in, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	d := json.NewDecoder(strings.NewReader(parameters))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&in); err != nil {
+		return invalid(err)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return invalid(fmt.Errorf("trailing data after arguments"))
+	}
+	if err := schema.Validate(t.params, []byte(parameters)); err != nil {
+		return invalid(err)
+	}
+	return in, nil
+}
@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type sum struct {
+	A int `json:"a"`
+	B int `json:"b,omitempty"`
+}
+
+func TestNewTool(t *testing.T) {
+	named := NewTool("add", "adds", func(_ context.Context, in sum) (int, error) {
+		return in.A + in.B, nil
+	})
+	anonymous := NewTool("shout", "shouts", func(_ context.Context, in struct {
+		Text string `json:"text"`
+	}) (string, error) {
+		return strings.ToUpper(in.Text), nil
+	})
+	for _, test := range []struct {
+		tool       ContextTool
+		properties []string
+		args, want string
+	}{
+		{named, []string{"a", "b"}, `{"a":1,"b":2}`, "3"},
+		{named, []string{"a", "b"}, ` {"a":1} `, "1"},
+		{anonymous, []string{"text"}, `{"text":"hi"}`, `"HI"`},
+	} {
+		def := test.tool.Defintion()
+		buf, err := json.Marshal(def.Parameters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var params struct {
+			Type       string
+			Properties map[string]any
+		}
+		if err := json.Unmarshal(buf, &params); err != nil {
+			t.Fatal(err)
+		}
+		var properties []string
+		for p := range params.Properties {
+			properties = append(properties, p)
+		}
+		slices.Sort(properties)
+		if params.Type != "object" || !reflect.DeepEqual(properties, test.properties) {
+			t.Errorf("%s: parameters %s", def.Name, buf)
+		}
+		got, err := test.tool.ComputeContext(context.Background(), test.args)
+		if err != nil || got != test.want {
+			t.Errorf("%s(%s) = %q, %v; want %q", def.Name, test.args, got, err, test.want)
+		}
+	}
+}
+
+func TestNewToolInvalid(t *testing.T) {
+	called := false
+	add := NewTool("add", "adds", func(_ context.Context, in sum) (int, error) {
+		called = true
+		return in.A + in.B, nil
+	})
+	for _, args := range []string{
+		``,
+		`not json`,
+		`{"a":"one"}`,
+		`{"a":1,"c":2}`,
+		`{"b":2}`,
+		`{"a":1} {"a":2}`,
+		`[1,2]`,
+		`null`,
+	} {
+		if _, err := add.ComputeContext(context.Background(), args); !errors.Is(err, ErrInvalidArguments) {
+			t.Errorf("%q: got %v", args, err)
+		}
+	}
+	if called {
+		t.Error("called with invalid arguments")
+	}
+}
+
+// types without a json schema fail when the tool is made, not when called
+func TestNewToolPanics(t *testing.T) {
+	defer func() {
+		r := recover()
+		if s, ok := r.(string); !ok || !strings.Contains(s, `tool "listen"`) || !strings.Contains(s, "chan") {
+			t.Errorf("recovered %v", r)
+		}
+	}()
+	NewTool("listen", "listens", func(_ context.Context, in struct{ C chan int }) (int, error) {
+		return 0, nil
+	})
+	t.Error("no panic")
+}
@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"xoba.com/llm/client"
+)
+
+// Usage is the token usage and estimated cost of asking a question,
+// across all its tool and retry rounds, including any summary of its history.
+// it excludes embedding the prompt for retrieval and transcribing its files,
+// as the Embedder and transcription apis report no tokens, and transcription
+// is priced by the minute anyway.
+type Usage struct {
+	Calls   []CallUsage             // each api call, in order
+	Total   client.Usage            // sum of all calls
+	ByModel map[string]client.Usage // sum of calls, by model name
+	Cost    float64                 // estimated dollars, per the models' pricing
+}
+
+// CallUsage is the usage of a single api call
+type CallUsage struct {
+	Model string // name of the model
+	client.Usage
+	Cost float64 // estimated dollars
+}
+
+// Add records a call of the model, for history strategies making their own.
+// a nil Usage records nothing.
+func (u *Usage) Add(m client.Model, x client.Usage) {
+	if u == nil {
+		return
+	}
+	name := m.Name
+	if len(name) == 0 {
+		name = m.Provider
+	}
+	cost := m.Pricing.Cost(x)
+	u.Calls = append(u.Calls, CallUsage{Model: name, Usage: x, Cost: cost})
+	u.Total = u.Total.Add(x)
+	if u.ByModel == nil {
+		u.ByModel = make(map[string]client.Usage)
+	}
+	u.ByModel[name] = u.ByModel[name].Add(x)
+	u.Cost += cost
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"xoba.com/llm/schema"
+)
+
+// Validator is optionally implemented by ANSWER types, to enforce rules
+// beyond their schema; violations are sent back to the model for repair
+type Validator interface {
+	Validate() error
+}
+
+// validate checks the answer as sent against the answer schema, then
+// the formal answer's own rules, if it has any and was supplied
+func validate[ANSWER any](content string, a *Answer[ANSWER]) error {
+	d := json.NewDecoder(strings.NewReader(content))
+	d.UseNumber()
+	var raw any
+	if err := d.Decode(&raw); err != nil {
+		return err
+	}
+	// nulls stand for omitted values, as in strict structured outputs:
+	raw = dropNulls(raw)
+	if err := schema.ValidateValue(answerSchema[ANSWER](), raw); err != nil {
+		return err
+	}
+	if m, ok := raw.(map[string]any); ok {
+		if _, ok := m["FormalAnswer"]; !ok {
+			return nil
+		}
+	}
+	if v, ok := any(a.FormalAnswer).(Validator); ok {
+		return v.Validate()
+	}
+	if v, ok := any(&a.FormalAnswer).(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+func dropNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if x == nil {
+				delete(v, k)
+			} else {
+				v[k] = dropNulls(x)
+			}
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = dropNulls(x)
+		}
+	}
+	return v
+}
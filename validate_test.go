@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"xoba.com/llm/client/fake"
+)
+
+type span struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+func (s span) Validate() error {
+	if s.From > s.To {
+		return errors.New("from is after to")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		content string
+		err     string
+	}{
+		{`{"ConversationalAnswer": "ok", "FormalAnswer": {"from": 1, "to": 2}}`, ""},
+		{`{"ConversationalAnswer": "ok", "FormalAnswer": {"from": "one", "to": 2}}`, "from"},
+		{`{"ConversationalAnswer": "ok", "FormalAnswer": {"from": 1}}`, "to"},
+		{`{"ConversationalAnswer": "ok", "FormalAnswer": {"from": 1.5, "to": 2}}`, "from"},
+		{`{"ConversationalAnswer": 3, "FormalAnswer": {"from": 1, "to": 2}}`, "ConversationalAnswer"},
+		// the answer's own rules:
+		{`{"ConversationalAnswer": "ok", "FormalAnswer": {"from": 3, "to": 2}}`, "from is after to"},
+		// nulls are omissions, and a formal answer needn't be given:
+		{`{"ConversationalAnswer": "can't say", "FormalAnswer": null}`, ""},
+	} {
+		var a Answer[span]
+		json.Unmarshal([]byte(c.content), &a)
+		err := validate(c.content, &a)
+		switch {
+		case len(c.err) == 0 && err != nil:
+			t.Errorf("%s: %v", c.content, err)
+		case len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: got %v, want %q", c.content, err, c.err)
+		}
+	}
+}
+
+// invalid answers are sent back to the model to repair
+func TestRepair(t *testing.T) {
+	c, s := asking(t,
+		fake.Reply{Content: `{"ConversationalAnswer": "here", "FormalAnswer": {"from": 3, "to": 2}}`},
+		fake.Reply{Content: `{"ConversationalAnswer": "here", "FormalAnswer": {"from": 2, "to": 3}}`})
+	resp, err := Ask(c, Question[span]{Prompt: "which span?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Answer.FormalAnswer != (span{2, 3}) {
+		t.Errorf("answered %+v", resp.Answer.FormalAnswer)
+	}
+	var req struct {
+		Messages []openai.ChatCompletionMessage
+	}
+	requests := s.Requests()
+	if len(requests) != 2 || json.Unmarshal(requests[1], &req) != nil {
+		t.Fatalf("%d requests", len(requests))
+	}
+	if last := req.Messages[len(req.Messages)-1]; last.Role != openai.ChatMessageRoleUser || !strings.Contains(last.Content, "from is after to") {
+		t.Errorf("asked to repair with %+v", last)
+	}
+}
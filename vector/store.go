@@ -0,0 +1,233 @@
+// package vector is a simple in-process vector store, for semantic search and dedup
+package vector
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+//go:generate stringer -type=Metric
+type Metric int
+
+const (
+	Cosine Metric = iota
+	Dot
+)
+
+// Item is a stored vector, identified by ID
+type Item struct {
+	ID       string
+	Vector   []float32
+	Metadata map[string]string
+}
+
+// Result is an item found by Search
+type Result struct {
+	Item
+	Score float64 // higher is more similar
+}
+
+// Filter selects items to search
+type Filter func(Item) bool
+
+// Match selects items whose metadata has the given value
+func Match(key, value string) Filter {
+	return func(i Item) bool {
+		v, ok := i.Metadata[key]
+		return ok && v == value
+	}
+}
+
+// All selects items passing every filter
+func All(filters ...Filter) Filter {
+	return func(i Item) bool {
+		for _, f := range filters {
+			if f != nil && !f(i) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Store holds vectors in memory, in insertion order. it's safe for concurrent use.
+type Store struct {
+	mu     sync.RWMutex
+	metric Metric
+	items  []Item
+	byID   map[string]int // index into items
+}
+
+func NewStore(m Metric) *Store {
+	return &Store{metric: m, byID: make(map[string]int)}
+}
+
+func (s *Store) Metric() Metric {
+	return s.metric
+}
+
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+// Upsert adds items, replacing those with the same ID
+func (s *Store) Upsert(items ...Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsert(items)
+}
+
+func (s *Store) upsert(items []Item) {
+	for _, x := range items {
+		if i, ok := s.byID[x.ID]; ok {
+			s.items[i] = x
+			continue
+		}
+		s.byID[x.ID] = len(s.items)
+		s.items = append(s.items, x)
+	}
+}
+
+// Get returns the item with the ID
+func (s *Store) Get(id string) (Item, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.byID[id]
+	if !ok {
+		return Item{}, false
+	}
+	return s.items[i], true
+}
+
+// Delete removes the items passing the filter, returning how many
+func (s *Store) Delete(f Filter) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.items)
+	s.items = slices.DeleteFunc(s.items, func(i Item) bool { return f(i) })
+	s.reindex()
+	return n - len(s.items)
+}
+
+// Replace removes the items passing the filter and adds the given ones in
+// one step, so searches see the old items or the new, never neither or both
+func (s *Store) Replace(f Filter, items ...Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = slices.DeleteFunc(s.items, func(i Item) bool { return f(i) })
+	s.reindex()
+	s.upsert(items)
+}
+
+func (s *Store) reindex() {
+	s.byID = make(map[string]int, len(s.items))
+	for i, x := range s.items {
+		s.byID[x.ID] = i
+	}
+}
+
+// Items returns the items passing the filter, or all for a nil one
+func (s *Store) Items(f Filter) []Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Item
+	for _, x := range s.items {
+		if f == nil || f(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// Search returns the k items most similar to v, among those passing the
+// filter, or all for a nil one. vectors of other dimensions are skipped.
+func (s *Store) Search(v []float32, k int, f Filter) []Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Result
+	for _, x := range s.items {
+		if len(x.Vector) != len(v) || (f != nil && !f(x)) {
+			continue
+		}
+		out = append(out, Result{Item: x, Score: s.metric.Score(v, x.Vector)})
+	}
+	slices.SortStableFunc(out, func(a, b Result) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return out[:min(max(k, 0), len(out))]
+}
+
+// Score is the similarity of equal-length vectors, higher meaning more similar
+func (m Metric) Score(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if m == Dot {
+		return dot
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// file is the persisted form of a store
+type file struct {
+	Metric Metric
+	Items  []Item
+}
+
+// Save writes the store to a file, atomically
+func (s *Store) Save(path string) error {
+	s.mu.RLock()
+	buf, err := json.Marshal(file{Metric: s.metric, Items: s.items})
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads a store written by Save
+func Load(path string) (*Store, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var x file
+	if err := json.Unmarshal(buf, &x); err != nil {
+		return nil, fmt.Errorf("can't load vector store %q: %w", path, err)
+	}
+	s := NewStore(x.Metric)
+	s.items = x.Items
+	s.reindex()
+	return s, nil
+}
@@ -0,0 +1,25 @@
+package vector
+
+import "testing"
+
+func TestReplace(t *testing.T) {
+	s := NewStore(Cosine)
+	s.Upsert(
+		Item{ID: "a1", Vector: []float32{1, 0}, Metadata: map[string]string{"file": "a"}},
+		Item{ID: "a2", Vector: []float32{0, 1}, Metadata: map[string]string{"file": "a"}},
+		Item{ID: "b1", Vector: []float32{1, 1}, Metadata: map[string]string{"file": "b"}},
+	)
+	s.Replace(Match("file", "a"), Item{ID: "a3", Vector: []float32{1, 0}, Metadata: map[string]string{"file": "a"}})
+	if s.Len() != 2 {
+		t.Fatalf("%d items", s.Len())
+	}
+	if _, ok := s.Get("a1"); ok {
+		t.Error("a1 not removed")
+	}
+	if _, ok := s.Get("b1"); !ok {
+		t.Error("b1 removed")
+	}
+	if r := s.Search([]float32{1, 0}, 1, nil); len(r) != 1 || r[0].ID != "a3" {
+		t.Errorf("got %+v", r)
+	}
+}